@@ -3,45 +3,128 @@ package agent
 import (
 	"chess-ai/database"
 	"chess-ai/game"
+	"chess-ai/game/polyglot"
 	"chess-ai/neural"
-	"math"
+	"context"
+	"fmt"
 	"math/rand"
+	"time"
 )
 
 // Agent представляет RL агента
 type Agent struct {
 	Network       *neural.Network
+	ModelPath     string // Файл модели для Save и Load
 	Color         game.Color
-	Epsilon       float64 // Вероятность случайного хода
+	Epsilon       float64 // Вероятность случайного хода при исследовании
+	Explore       bool    // Делать ли случайные ходы с вероятностью Epsilon (только в самообучении)
 	Gamma         float64 // Коэффициент дисконтирования
 	StateHistory  [][]float64
 	RewardHistory []float64
 	Database      *database.Database // База данных для анализа ходов
 	UseDatabase   bool               // Использовать ли базу данных при выборе хода
+	Book          *polyglot.Book     // Дебютная книга (nil - не использовать)
+	Limits        SearchLimits       // Ограничения поиска при выборе хода
+	Threads       int                // Количество потоков поиска
+
+	tt         *transpositionTable // Таблица транспозиций, общая для всех поисков агента
+	skillLevel int32               // Уровень силы игры (см. SetSkillLevel)
+}
+
+// DefaultSearchLimits - ограничения поиска по умолчанию: одна секунда на ход
+var DefaultSearchLimits = SearchLimits{MoveTime: time.Second}
+
+// SelfPlaySearchLimits - ограничения поиска в самообучении, где скорость важнее силы игры
+var SelfPlaySearchLimits = SearchLimits{Depth: 2}
+
+// InputSize - размер входа нейросети: кодировка доски encodeBoard
+// (12 битовых плоскостей по 64 клетки)
+const InputSize = 12 * 64
+
+// InputEncoding - название кодировки encodeBoard. Оно записывается в файл модели,
+// чтобы сеть, обученная на другой кодировке, не загрузилась по ошибке.
+const InputEncoding = "planes12x64"
+
+// DefaultModelPath - файл модели агента по умолчанию
+const DefaultModelPath = "models/default.model"
+
+// NetworkLayers - слои нейросети, создаваемой для новых агентов
+var NetworkLayers = neural.DefaultLayers
+
+// NetworkConfig возвращает архитектуру нейросети агента: вход из кодировки доски и слои NetworkLayers
+func NetworkConfig() neural.Config {
+	return neural.Config{InputSize: InputSize, Layers: NetworkLayers}
 }
 
 // NewAgent создает нового агента
 func NewAgent(color game.Color) *Agent {
+	network := neural.NewNetwork(NetworkConfig())
+	network.InputEncoding = InputEncoding
 	return &Agent{
-		Network:     neural.NewNetwork(),
+		Network:     network,
+		ModelPath:   DefaultModelPath,
 		Color:       color,
 		Epsilon:     0.1,
 		Gamma:       0.99,
 		UseDatabase: false,
+		Limits:      DefaultSearchLimits,
+		Threads:     1,
+		tt:          newTranspositionTable(DefaultHashSize),
+		skillLevel:  MaxSkillLevel,
 	}
 }
 
+// SetHashSize задает размер таблицы транспозиций в мегабайтах. Таблица
+// создается заново, поэтому менять размер во время поиска нельзя.
+func (a *Agent) SetHashSize(mb int) {
+	a.tt = newTranspositionTable(mb)
+}
+
+// NewGame готовит агента к новой партии: очищает таблицу транспозиций, ведь
+// после обучения нейросети сохраненные оценки устаревают
+func (a *Agent) NewGame() {
+	a.tt.clear()
+}
+
 // SetDatabase устанавливает базу данных для агента
 func (a *Agent) SetDatabase(db *database.Database, use bool) {
 	a.Database = db
 	a.UseDatabase = use
 }
 
-// ChooseMove выбирает ход используя epsilon-greedy стратегию
+// BookMove выбирает ход из дебютной книги, если она задана и содержит позицию
+func (a *Agent) BookMove(board *game.Board) (game.Move, bool) {
+	if a.Book == nil {
+		return game.Move{}, false
+	}
+	return a.Book.Move(board)
+}
+
+// ChooseMove выбирает ход. При самообучении (Explore) используется epsilon-greedy
+// стратегия, а в игре ход ослабляет только уровень силы.
 func (a *Agent) ChooseMove(board *game.Board) game.Move {
+	return a.ChooseMoveContext(context.Background(), board).BestMove
+}
+
+// ChooseMoveContext выбирает ход, как ChooseMove, и возвращает его в BestMove вместе
+// с результатом поиска. Если ход выбран без поиска (из книги, базы данных или случайно),
+// Depth равен нулю. Отмена ctx прерывает поиск, и возвращается лучший ход
+// последней завершенной итерации.
+func (a *Agent) ChooseMoveContext(ctx context.Context, board *game.Board) SearchResult {
+	return a.ChooseMoveLimits(ctx, board, a.Limits)
+}
+
+// ChooseMoveLimits выбирает ход, как ChooseMoveContext, но ищет в пределах limits
+// (например, на времени соперника)
+func (a *Agent) ChooseMoveLimits(ctx context.Context, board *game.Board, limits SearchLimits) SearchResult {
 	moves := board.GetLegalMoves()
 	if len(moves) == 0 {
-		return game.Move{}
+		return SearchResult{}
+	}
+
+	// В дебюте играем ходы из книги
+	if move, ok := a.BookMove(board); ok {
+		return SearchResult{BestMove: move}
 	}
 
 	// Если включена база данных, пробуем найти лучший ход из истории
@@ -52,116 +135,54 @@ func (a *Agent) ChooseMove(board *game.Board) game.Move {
 			// Если есть статистика с достаточным количеством игр, используем лучший ход
 			for _, move := range moves {
 				if move.From == stats.BestMove.From && move.To == stats.BestMove.To {
-					return move
+					return SearchResult{BestMove: move}
 				}
 			}
 		}
 	}
 
-	// Epsilon-greedy: случайный ход с вероятностью epsilon
-	if rand.Float64() < a.Epsilon {
-		return moves[rand.Intn(len(moves))]
+	// Epsilon-greedy при самообучении: случайный ход с вероятностью epsilon
+	if a.Explore && rand.Float64() < a.Epsilon {
+		return SearchResult{BestMove: moves[rand.Intn(len(moves))]}
 	}
 
-	// Иначе используем minimax с альфа-бета отсечением
-	_, bestMove := a.minimax(board, 2, -math.MaxFloat64, math.MaxFloat64, true)
-	if bestMove.From.Row == -1 {
-		return moves[rand.Intn(len(moves))]
+	// Иначе ищем ход итеративным углублением в пределах limits
+	result := a.Search(ctx, board, limits, nil)
+	if result.Depth == 0 {
+		return SearchResult{BestMove: moves[rand.Intn(len(moves))], Nodes: result.Nodes, Time: result.Time}
 	}
 
-	return bestMove
-}
-
-// minimax реализует алгоритм minimax с альфа-бета отсечением
-func (a *Agent) minimax(board *game.Board, depth int, alpha, beta float64, maximizing bool) (float64, game.Move) {
-	if depth == 0 || board.GameOver {
-		return a.evaluatePosition(board), game.Move{From: game.Position{-1, -1}}
-	}
-
-	moves := board.GetLegalMoves()
-	if len(moves) == 0 {
-		return a.evaluatePosition(board), game.Move{From: game.Position{-1, -1}}
-	}
-
-	var bestMove game.Move
-	bestMove.From = game.Position{-1, -1}
-
-	if maximizing {
-		maxEval := -math.MaxFloat64
-		for _, move := range moves {
-			boardCopy := board.Clone()
-			boardCopy.MakeMove(move)
-			eval, _ := a.minimax(boardCopy, depth-1, alpha, beta, false)
-
-			if eval > maxEval {
-				maxEval = eval
-				bestMove = move
-			}
-
-			alpha = math.Max(alpha, eval)
-			if beta <= alpha {
-				break // Альфа-бета отсечение
-			}
-		}
-		return maxEval, bestMove
-	} else {
-		minEval := math.MaxFloat64
-		for _, move := range moves {
-			boardCopy := board.Clone()
-			boardCopy.MakeMove(move)
-			eval, _ := a.minimax(boardCopy, depth-1, alpha, beta, true)
-
-			if eval < minEval {
-				minEval = eval
-				bestMove = move
-			}
-
-			beta = math.Min(beta, eval)
-			if beta <= alpha {
-				break
-			}
-		}
-		return minEval, bestMove
-	}
-}
-
-// evaluatePosition оценивает позицию с помощью нейросети
-func (a *Agent) evaluatePosition(board *game.Board) float64 {
-	input := a.boardToVector(board)
-	return a.Network.Forward(input)
+	return result
 }
 
 // boardToVector преобразует доску в вектор (12 битовых плоскостей)
 func (a *Agent) boardToVector(board *game.Board) []float64 {
-	vector := make([]float64, 768) // 12 плоскостей * 64 клетки
+	vector := make([]float64, InputSize)
+	encodeBoard(board, vector)
+	return vector
+}
 
-	pieceTypes := []game.PieceType{
-		game.Pawn, game.Knight, game.Bishop,
-		game.Rook, game.Queen, game.King,
+// encodeBoard записывает доску в готовый вектор из InputSize элементов: плоскости
+// пешек, коней, слонов, ладей, ферзей и королей белых, затем то же для черных
+func encodeBoard(board *game.Board, vector []float64) {
+	for i := range vector {
+		vector[i] = 0
 	}
 
-	for planeIdx := 0; planeIdx < 12; planeIdx++ {
-		pieceType := pieceTypes[planeIdx%6]
-		color := game.White
-		if planeIdx >= 6 {
-			color = game.Black
-		}
-
-		for row := 0; row < 8; row++ {
-			for col := 0; col < 8; col++ {
-				piece := board.Cells[row][col]
-				idx := planeIdx*64 + row*8 + col
+	for row := 0; row < 8; row++ {
+		for col := 0; col < 8; col++ {
+			piece := board.Cells[row][col]
+			if piece.Type == game.Empty {
+				continue
+			}
 
-				if piece.Type == pieceType && piece.Color == color {
-					vector[idx] = 1.0
-				} else {
-					vector[idx] = 0.0
-				}
+			planeIdx := int(piece.Type - game.Pawn)
+			if piece.Color == game.Black {
+				planeIdx += 6
 			}
+			vector[planeIdx*64+row*8+col] = 1.0
 		}
 	}
-
-	return vector
 }
 
 // RecordState записывает состояние для последующего обучения
@@ -193,14 +214,24 @@ func (a *Agent) Learn(finalReward float64) {
 	}
 }
 
-// Save сохраняет состояние агента
+// Save сохраняет нейросеть агента в файл ModelPath
 func (a *Agent) Save() error {
-	return a.Network.Save()
+	return a.Network.Save(a.ModelPath)
 }
 
-// Load загружает состояние агента
+// Load загружает нейросеть агента из файла ModelPath. Модель, обученная
+// для другой кодировки входа, не загружается, и агент сохраняет прежнюю сеть.
 func (a *Agent) Load() error {
-	return a.Network.Load()
+	network, err := neural.LoadNetwork(a.ModelPath)
+	if err != nil {
+		return err
+	}
+	if network.InputEncoding != InputEncoding || network.Config.InputSize != InputSize {
+		return fmt.Errorf("%s: модель обучена для входа %s (%d), а агент использует %s (%d)",
+			a.ModelPath, network.InputEncoding, network.Config.InputSize, InputEncoding, InputSize)
+	}
+	a.Network = network
+	return nil
 }
 
 // GetMovesCount возвращает количество ходов в текущей игре
@@ -0,0 +1,189 @@
+package agent
+
+import (
+	"bufio"
+	"chess-ai/database"
+	"chess-ai/game"
+	"chess-ai/neural"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Целевые оценки позиций для обучения с учителем те же, что и награды Learn:
+// очки стороны, которая делает ход, - 1 (победа), 0.5 (ничья) или 0 (поражение).
+
+// ParseTarget разбирает целевую оценку позиции board: результат партии
+// ("1-0", "0-1", "1/2-1/2") или число от 0 до 1 - оценку для стороны, которая делает ход
+func ParseTarget(s string, board *game.Board) (float64, error) {
+	switch s {
+	case "1-0":
+		return game.WhiteWins.ScoreFor(board.CurrentTurn), nil
+	case "0-1":
+		return game.BlackWins.ScoreFor(board.CurrentTurn), nil
+	case "1/2-1/2":
+		return game.Draw.ScoreFor(board.CurrentTurn), nil
+	}
+
+	target, err := strconv.ParseFloat(s, 64)
+	if err != nil || target < 0 || target > 1 {
+		return 0, fmt.Errorf("неверная оценка %q (ожидается 1-0, 0-1, 1/2-1/2 или число от 0 до 1)", s)
+	}
+	return target, nil
+}
+
+// ReadDataset читает позиции для обучения с учителем: по строке на позицию
+// в виде "FEN;оценка" (см. ParseTarget). Пустые строки и строки, начинающиеся
+// с #, пропускаются.
+func ReadDataset(r io.Reader) (*neural.Dataset, error) {
+	data := &neural.Dataset{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		idx := strings.LastIndex(text, ";")
+		if idx < 0 {
+			return nil, fmt.Errorf("строка %d: ожидается FEN;оценка", line)
+		}
+		board, err := game.ParseFEN(strings.TrimSpace(text[:idx]))
+		if err != nil {
+			return nil, fmt.Errorf("строка %d: %v", line, err)
+		}
+		target, err := ParseTarget(strings.TrimSpace(text[idx+1:]), board)
+		if err != nil {
+			return nil, fmt.Errorf("строка %d: %v", line, err)
+		}
+
+		input := make([]float64, InputSize)
+		encodeBoard(board, input)
+		data.Add(input, target)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// LoadDataset читает позиции для обучения с учителем из файла (см. ReadDataset)
+func LoadDataset(path string) (*neural.Dataset, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := ReadDataset(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return data, nil
+}
+
+// SkippedGames - количество партий, не вошедших в набор, по причинам
+type SkippedGames struct {
+	OtherStart   int // Начаты не из начальной позиции (ключ позиции в базе не совпадает)
+	IllegalMoves int // Записанный ход нелегален в восстановленной позиции
+}
+
+// Total возвращает общее количество пропущенных партий
+func (s SkippedGames) Total() int {
+	return s.OtherStart + s.IllegalMoves
+}
+
+// DatasetFromGames собирает позиции перед каждым ходом партий из базы данных
+// с результатом партии в качестве оценки и делит их на обучающий и проверочный
+// наборы по партиям: в проверочный попадает доля validationFraction случайных партий.
+// Позиции одной партии похожи, и при делении по позициям проверка оказалась бы
+// на почти тех же позициях, что и обучение.
+// Позиции восстанавливаются повтором ходов от начальной позиции. Ключ восстановленной
+// позиции сверяется с записанным, если тот в формате Zobrist; в старых записях ключ
+// другого формата, и такие партии проверяются только легальностью ходов. Партии,
+// начатые из другой позиции или с нелегальным ходом, пропускаются.
+func DatasetFromGames(games []database.GameRecord, validationFraction float64) (train, validation *neural.Dataset, skipped SkippedGames) {
+	var positions []*neural.Dataset
+	for _, record := range games {
+		data, ok := gamePositions(record, &skipped)
+		if ok {
+			positions = append(positions, data)
+		}
+	}
+
+	rand.Shuffle(len(positions), func(i, j int) {
+		positions[i], positions[j] = positions[j], positions[i]
+	})
+	n := len(positions) - int(float64(len(positions))*validationFraction)
+	train, validation = &neural.Dataset{}, &neural.Dataset{}
+	for i, data := range positions {
+		target := train
+		if i >= n {
+			target = validation
+		}
+		target.Inputs = append(target.Inputs, data.Inputs...)
+		target.Targets = append(target.Targets, data.Targets...)
+	}
+	return train, validation, skipped
+}
+
+// gamePositions восстанавливает позиции партии record. Если партию нельзя
+// восстановить, причина учитывается в skipped и возвращается false.
+func gamePositions(record database.GameRecord, skipped *SkippedGames) (*neural.Dataset, bool) {
+	var result game.Result
+	switch record.Winner {
+	case game.WhiteWins.WinnerName():
+		result = game.WhiteWins
+	case game.BlackWins.WinnerName():
+		result = game.BlackWins
+	default:
+		result = game.Draw
+	}
+
+	data := &neural.Dataset{}
+	board := game.NewBoard()
+	for _, m := range record.Moves {
+		if database.IsZobristHash(m.BoardHash) && m.BoardHash != database.GenerateBoardHash(board) {
+			skipped.OtherStart++
+			return nil, false
+		}
+		move, err := recordedMove(board, m)
+		if err != nil {
+			skipped.IllegalMoves++
+			return nil, false
+		}
+
+		input := make([]float64, InputSize)
+		encodeBoard(board, input)
+		data.Add(input, result.ScoreFor(board.CurrentTurn))
+		board.MakeMove(move)
+	}
+	return data, true
+}
+
+// recordedMove восстанавливает легальный ход из записи базы данных. В старых записях
+// нет хода в нотации UCI, и превращение пешки считается превращением в ферзя.
+func recordedMove(board *game.Board, m database.MoveRecord) (game.Move, error) {
+	if m.UCI != "" {
+		return board.ParseMove(m.UCI)
+	}
+
+	move := game.Move{
+		From: game.Position{Row: m.FromRow, Col: m.FromCol},
+		To:   game.Position{Row: m.ToRow, Col: m.ToCol},
+	}
+	if !onBoard(move.From) || !onBoard(move.To) {
+		return game.Move{}, fmt.Errorf("неверный ход %d в партии %d", m.MoveNumber, m.GameID)
+	}
+	if board.Cells[move.From.Row][move.From.Col].Type == game.Pawn && (move.To.Row == 0 || move.To.Row == 7) {
+		move.Promotion = game.Queen
+	}
+	return board.ParseMove(move.UCI())
+}
+
+func onBoard(p game.Position) bool {
+	return p.Row >= 0 && p.Row <= 7 && p.Col >= 0 && p.Col <= 7
+}
@@ -0,0 +1,113 @@
+package agent
+
+import "chess-ai/game"
+
+// Приоритеты при упорядочивании ходов: ход из таблицы транспозиций, затем взятия
+// и превращения (MVV-LVA), затем ходы-убийцы, затем тихие ходы по истории отсечений
+const (
+	orderTTMove  = 1 << 30
+	orderCapture = 1 << 20
+	orderKiller  = 1 << 19
+
+	// historyLimit - предел счетчика истории; при его достижении все счетчики
+	// уменьшаются вдвое, чтобы история оставалась ниже ходов-убийц и учитывала свежие отсечения
+	historyLimit = orderKiller / 2
+)
+
+// moveOrderer хранит эвристики упорядочивания ходов одного поиска
+type moveOrderer struct {
+	killers [MaxSearchDepth + 1][2]game.Move // Тихие ходы, давшие отсечение на том же расстоянии от корня
+	history [2][64][64]int                   // Счетчики отсечений тихих ходов по цвету и клеткам "откуда" и "куда"
+}
+
+// newMoveOrderer создает пустые таблицы эвристик
+func newMoveOrderer() *moveOrderer {
+	o := &moveOrderer{}
+	for ply := range o.killers {
+		o.killers[ply] = [2]game.Move{noMove, noMove}
+	}
+	return o
+}
+
+// isQuiet проверяет, что ход не является взятием или превращением
+func isQuiet(board *game.Board, move game.Move) bool {
+	return board.CapturedPiece(move).Type == game.Empty && !board.IsPromotion(move)
+}
+
+// squareOf возвращает номер клетки для таблицы истории
+func squareOf(pos game.Position) int {
+	return pos.Row*8 + pos.Col
+}
+
+// orderMoves сортирует ходы по убыванию приоритета. ply < 0 означает, что
+// ходы-убийцы не используются (форсированный вариант).
+func (o *moveOrderer) orderMoves(board *game.Board, moves []game.Move, ttMove game.Move, ply int) {
+	scores := make([]int, len(moves))
+	for i, move := range moves {
+		scores[i] = o.score(board, move, ttMove, ply)
+	}
+
+	// Сортировка вставками: ходов немного, и она не выделяет память
+	for i := 1; i < len(moves); i++ {
+		move, score := moves[i], scores[i]
+		j := i
+		for ; j > 0 && scores[j-1] < score; j-- {
+			moves[j], scores[j] = moves[j-1], scores[j-1]
+		}
+		moves[j], scores[j] = move, score
+	}
+}
+
+// score вычисляет приоритет хода
+func (o *moveOrderer) score(board *game.Board, move, ttMove game.Move, ply int) int {
+	if move == ttMove {
+		return orderTTMove
+	}
+
+	// MVV-LVA: сначала самая ценная взятая фигура, при равенстве - самым дешевым нападающим
+	victim := board.CapturedPiece(move)
+	promotion := board.IsPromotion(move)
+	if victim.Type != game.Empty || promotion {
+		attacker := board.Cells[move.From.Row][move.From.Col].Type
+		score := orderCapture + int(victim.Type)*8 - int(attacker)
+		if promotion {
+			piece := move.Promotion
+			if piece == game.Empty {
+				piece = game.Queen
+			}
+			score += int(piece) * 8
+		}
+		return score
+	}
+
+	if ply >= 0 && ply < len(o.killers) {
+		if move == o.killers[ply][0] {
+			return orderKiller
+		}
+		if move == o.killers[ply][1] {
+			return orderKiller - 1
+		}
+	}
+
+	return o.history[board.CurrentTurn][squareOf(move.From)][squareOf(move.To)]
+}
+
+// update запоминает тихий ход, давший отсечение на глубине depth
+func (o *moveOrderer) update(color game.Color, move game.Move, depth, ply int) {
+	if ply < len(o.killers) && o.killers[ply][0] != move {
+		o.killers[ply][1] = o.killers[ply][0]
+		o.killers[ply][0] = move
+	}
+
+	h := &o.history[color][squareOf(move.From)][squareOf(move.To)]
+	*h += depth * depth
+	if *h >= historyLimit {
+		for c := range o.history {
+			for from := range o.history[c] {
+				for to := range o.history[c][from] {
+					o.history[c][from][to] /= 2
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,683 @@
+package agent
+
+import (
+	"chess-ai/game"
+	"context"
+	"math"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// MaxSearchDepth - предельная глубина итеративного углубления
+	MaxSearchDepth = 64
+	// defaultMovesToGo - на сколько ходов делится оставшееся время, если их число неизвестно
+	defaultMovesToGo = 30
+
+	// MateScore - оценка мата: мат через ply полуходов от корня оценивается
+	// MateScore - ply. Оценки нейросети (от -1 до 1) намного меньше.
+	MateScore = 1000.0
+	// mateThreshold - оценки больше по модулю означают форсированный мат
+	mateThreshold = MateScore / 2
+)
+
+// SearchLimits - ограничения поиска. Нулевое значение поля означает отсутствие ограничения;
+// если не задано ни одно ограничение, поиск идет до отмены контекста.
+type SearchLimits struct {
+	Depth        int           // Максимальная глубина
+	Nodes        uint64        // Максимальное количество позиций
+	MoveTime     time.Duration // Точное время на ход
+	TimeLeft     time.Duration // Оставшееся время на часах стороны, которая делает ход
+	Increment    time.Duration // Добавка времени за ход
+	MovesToGo    int           // Ходов до следующего контроля времени (0 - неизвестно)
+	MoveOverhead time.Duration // Запас времени на задержки связи
+
+	// Ponder, если не nil, означает поиск на времени соперника в позиции после его
+	// ожидаемого хода: ограничения по времени начинают отсчитываться только после
+	// закрытия канала (соперник сделал ожидаемый ход), а до этого поиск не ограничен по времени
+	Ponder <-chan struct{}
+}
+
+// timeBudget распределяет время на ход. Новая итерация не начинается после soft,
+// а поиск прерывается после hard. Нули означают поиск без ограничения по времени.
+func (l SearchLimits) timeBudget() (soft, hard time.Duration) {
+	if l.MoveTime > 0 {
+		hard = maxDuration(l.MoveTime-l.MoveOverhead, time.Millisecond)
+		return hard, hard
+	}
+	if l.TimeLeft <= 0 {
+		return 0, 0
+	}
+
+	movesToGo := l.MovesToGo
+	if movesToGo <= 0 {
+		movesToGo = defaultMovesToGo
+	}
+	optimum := l.TimeLeft/time.Duration(movesToGo) + l.Increment*3/4
+
+	// Следующая итерация обычно в несколько раз дольше предыдущей, поэтому не начинаем
+	// ее после половины отведенного времени. Прерывать поиск разрешаем не позже
+	// чем через четыре отведенных времени и не позже трети оставшегося на часах.
+	available := maxDuration(l.TimeLeft-l.MoveOverhead, time.Millisecond)
+	soft = minDuration(optimum/2, available)
+	hard = minDuration(minDuration(optimum*4, l.TimeLeft/3), available)
+	return maxDuration(soft, time.Millisecond), maxDuration(hard, time.Millisecond)
+}
+
+// SearchResult - результат поиска (последней завершенной итерации)
+type SearchResult struct {
+	BestMove game.Move
+	Score    float64       // Оценка позиции для стороны, которая делает ход (см. MateIn)
+	PV       []game.Move   // Главный вариант, начиная с BestMove
+	Depth    int           // Глубина последней завершенной итерации (0 - ни одна не завершилась)
+	Nodes    uint64        // Количество просмотренных позиций
+	Time     time.Duration // Время от начала поиска
+}
+
+// SAN записывает главный вариант в алгебраической нотации, начиная с позиции board
+func (r SearchResult) SAN(board *game.Board) string {
+	board = board.Clone()
+	line := make([]string, 0, len(r.PV))
+	for _, move := range r.PV {
+		if !board.IsValidMove(move) {
+			break
+		}
+		line = append(line, board.SAN(move))
+		board.MakeMove(move)
+	}
+	return strings.Join(line, " ")
+}
+
+// MateIn переводит оценку форсированного мата в число ходов до мата: положительное,
+// если мат ставит сторона, которая делает ход, и отрицательное, если ставят ей.
+// Для оценок без мата возвращает false.
+func MateIn(score float64) (int, bool) {
+	if math.Abs(score) < mateThreshold {
+		return 0, false
+	}
+	plies := int(math.Round(MateScore - math.Abs(score)))
+	if score > 0 {
+		return (plies + 1) / 2, true
+	}
+	return -plies / 2, true
+}
+
+// terminalScore оценивает законченную партию для стороны, которая делает ход:
+// мат - проигрыш, тем меньший, чем дальше он от корня, остальные окончания - ничья
+func terminalScore(board *game.Board, ply int) float64 {
+	if board.Termination == game.Checkmate {
+		return -(MateScore - float64(ply))
+	}
+	return 0
+}
+
+// scoreToTT переводит оценку мата из расстояния от корня в расстояние от позиции ply,
+// чтобы запись таблицы транспозиций подходила позиции на любом расстоянии от корня
+func scoreToTT(score float64, ply int) float64 {
+	switch {
+	case score >= mateThreshold:
+		return score + float64(ply)
+	case score <= -mateThreshold:
+		return score - float64(ply)
+	}
+	return score
+}
+
+// scoreFromTT - обратное к scoreToTT преобразование для позиции ply
+func scoreFromTT(score float64, ply int) float64 {
+	switch {
+	case score >= mateThreshold:
+		return score - float64(ply)
+	case score <= -mateThreshold:
+		return score + float64(ply)
+	}
+	return score
+}
+
+// noMove обозначает отсутствие хода
+var noMove = game.Move{From: game.Position{Row: -1, Col: -1}}
+
+// sharedSearch - состояние, общее для всех потоков одного поиска
+type sharedSearch struct {
+	nodes    uint64          // Позиции, просмотренные всеми потоками (атомарный счетчик)
+	maxNodes uint64          // Лимит позиций (0 - без ограничения)
+	done     <-chan struct{} // Закрывается при отмене поиска или истечении времени
+
+	// Шум оценки на неполной силе игры: амплитуда (0 - без шума) и зерно,
+	// от которого шум зависит наряду с позицией
+	noise     float64
+	noiseSeed uint64
+}
+
+// search - состояние одного потока поиска. Ходы делаются и отменяются на своей копии
+// доски, а повторно встретившиеся позиции берутся из таблицы транспозиций агента,
+// общей для всех потоков (Lazy SMP).
+type search struct {
+	agent    *Agent
+	shared   *sharedSearch
+	board    *game.Board
+	tt       *transpositionTable
+	keyMix   uint64 // Добавка к ключу Zobrist (зерно шума на неполной силе игры)
+	orderer  *moveOrderer
+	input    []float64 // Буфер входа нейросети
+	aborted  bool
+	excluded []game.Move // Ходы в корне, уже вошедшие в другие варианты анализа
+
+	// Треугольная таблица главных вариантов: pv[ply][ply:pvLength[ply]] - лучший
+	// найденный вариант из позиции на расстоянии ply от корня
+	pv       [MaxSearchDepth + 1][MaxSearchDepth + 1]game.Move
+	pvLength [MaxSearchDepth + 1]int
+}
+
+// Search ищет ход итеративным углублением: negamax-поиск с альфа-бета отсечением
+// на глубину 1, 2, 3... пока позволяют limits. Поиск прерывается при отмене ctx или
+// исчерпании лимитов и возвращает результат последней завершенной итерации
+// (если не завершилась ни одна - первый легальный ход). report, если не nil,
+// вызывается после каждой завершенной итерации. Ход выбирается с учетом уровня силы.
+func (a *Agent) Search(ctx context.Context, board *game.Board, limits SearchLimits, report func(SearchResult)) SearchResult {
+	var reportLines func([]SearchResult)
+	if report != nil {
+		reportLines = func(lines []SearchResult) { report(lines[0]) }
+	}
+
+	best, lines := a.SearchLines(ctx, board, limits, 1, reportLines)
+	if len(lines) == 0 {
+		return SearchResult{BestMove: noMove}
+	}
+	return best
+}
+
+// SearchLines ищет ход для игры с учетом уровня силы и возвращает выбранный ход
+// вместе с multiPV лучшими вариантами. На полной силе выбирается первый вариант, иначе
+// поиск ограничен и оценки зашумлены, а ход выбирается среди нескольких почти лучших,
+// поэтому вариантов может быть просмотрено больше, чем multiPV.
+func (a *Agent) SearchLines(ctx context.Context, board *game.Board, limits SearchLimits, multiPV int, report func([]SearchResult)) (SearchResult, []SearchResult) {
+	level := a.SkillLevel()
+	if multiPV < 1 {
+		multiPV = 1
+	}
+
+	trim := func(lines []SearchResult) []SearchResult {
+		if len(lines) > multiPV {
+			return lines[:multiPV]
+		}
+		return lines
+	}
+	var reportLines func([]SearchResult)
+	if report != nil {
+		reportLines = func(lines []SearchResult) { report(trim(lines)) }
+	}
+
+	candidates := multiPV
+	if n := skillCandidates(level); n > candidates {
+		candidates = n
+	}
+	lines := a.analyze(ctx, board, skillLimits(level, limits), candidates, level, reportLines)
+	if len(lines) == 0 {
+		return SearchResult{BestMove: noMove}, nil
+	}
+	return selectMove(level, lines), trim(lines)
+}
+
+// Analyze ищет multiPV лучших ходов в позиции board и возвращает их варианты
+// по убыванию оценки (меньше, если легальных ходов меньше multiPV)
+func (a *Agent) Analyze(board *game.Board, limits SearchLimits, multiPV int) []SearchResult {
+	return a.AnalyzeContext(context.Background(), board, limits, multiPV, nil)
+}
+
+// AnalyzeContext выполняет анализ, как Analyze, с возможностью прервать его через ctx.
+// На каждой глубине сначала ищется лучший ход, затем лучший из остальных и так далее.
+// Возвращаются варианты последней завершенной итерации; report, если не nil,
+// вызывается после каждой завершенной итерации. Анализ всегда ведется в полную силу.
+func (a *Agent) AnalyzeContext(ctx context.Context, board *game.Board, limits SearchLimits, multiPV int, report func([]SearchResult)) []SearchResult {
+	return a.analyze(ctx, board, limits, multiPV, MaxSkillLevel, report)
+}
+
+// analyze выполняет анализ с оценками, зашумленными по уровню силы level
+func (a *Agent) analyze(ctx context.Context, board *game.Board, limits SearchLimits, multiPV, level int, report func([]SearchResult)) []SearchResult {
+	start := time.Now()
+	moves := board.GetLegalMoves()
+	if len(moves) == 0 {
+		return nil
+	}
+	if multiPV < 1 {
+		multiPV = 1
+	}
+	if multiPV > len(moves) {
+		multiPV = len(moves)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	soft, hard := limits.timeBudget()
+	clock := &searchClock{soft: soft, hard: hard}
+	defer clock.stop()
+	if limits.Ponder == nil {
+		clock.begin(cancel)
+	} else {
+		go clock.waitPonderHit(ctx, limits.Ponder, cancel)
+	}
+
+	maxDepth := limits.Depth
+	if maxDepth <= 0 || maxDepth > MaxSearchDepth {
+		maxDepth = MaxSearchDepth
+	}
+
+	// Вспомогательные потоки ищут ту же позицию, начиная с разной глубины, и делятся
+	// найденным через таблицу транспозиций. Они останавливаются вместе с основным.
+	ctx, stopHelpers := context.WithCancel(ctx)
+	shared := &sharedSearch{maxNodes: limits.Nodes, done: ctx.Done()}
+	if level < MaxSkillLevel {
+		shared.noise = skillNoise(level)
+		shared.noiseSeed = rand.Uint64()
+	}
+	var helpers sync.WaitGroup
+	for i := 1; i < a.Threads; i++ {
+		helper := a.newSearch(board, shared)
+		helpers.Add(1)
+		go func(startDepth int) {
+			defer helpers.Done()
+			helper.iterate(startDepth, maxDepth)
+		}(1 + i%2)
+	}
+
+	s := a.newSearch(board, shared)
+
+	// Пока не завершилась ни одна итерация, вариантами считаются первые легальные ходы
+	best := make([]SearchResult, multiPV)
+	for i := range best {
+		best[i] = SearchResult{BestMove: moves[i]}
+	}
+
+	for depth := 1; depth <= maxDepth; depth++ {
+		lines := make([]SearchResult, 0, multiPV)
+		s.excluded = s.excluded[:0]
+		for len(lines) < multiPV {
+			score := s.negamax(depth, 0, -math.MaxFloat64, math.MaxFloat64)
+			if s.aborted {
+				break
+			}
+			lines = append(lines, SearchResult{
+				BestMove: s.pv[0][0],
+				Score:    score,
+				PV:       s.principalVariation(depth),
+				Depth:    depth,
+			})
+			s.excluded = append(s.excluded, s.pv[0][0])
+		}
+		if s.aborted {
+			break
+		}
+
+		for i := range lines {
+			lines[i].Nodes = shared.visited()
+			lines[i].Time = time.Since(start)
+		}
+		best = lines
+		if report != nil {
+			report(best)
+		}
+
+		// Единственный ход не нужно обдумывать, если поиск ограничен временем
+		if clock.limited() && len(moves) == 1 {
+			break
+		}
+		if clock.softExpired() {
+			break
+		}
+	}
+
+	stopHelpers()
+	helpers.Wait()
+
+	for i := range best {
+		best[i].Nodes = shared.visited()
+		best[i].Time = time.Since(start)
+	}
+	return best
+}
+
+// searchClock отсчитывает время на ход. При поиске на времени соперника
+// отсчет начинается только после ponderhit.
+type searchClock struct {
+	soft, hard time.Duration
+
+	mu      sync.Mutex
+	started bool
+	start   time.Time
+	timer   *time.Timer // Прерывает поиск по истечении hard
+}
+
+// begin начинает отсчет времени; cancel вызывается по истечении hard
+func (c *searchClock) begin(cancel context.CancelFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.started = true
+	c.start = time.Now()
+	if c.hard > 0 {
+		c.timer = time.AfterFunc(c.hard, cancel)
+	}
+}
+
+// waitPonderHit начинает отсчет времени, когда закроется канал hit
+func (c *searchClock) waitPonderHit(ctx context.Context, hit <-chan struct{}, cancel context.CancelFunc) {
+	select {
+	case <-hit:
+		c.begin(cancel)
+	case <-ctx.Done():
+	}
+}
+
+// limited сообщает, идет ли отсчет ограниченного времени
+func (c *searchClock) limited() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.started && c.hard > 0
+}
+
+// softExpired сообщает, что новую итерацию начинать уже не стоит
+func (c *searchClock) softExpired() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.started && c.soft > 0 && time.Since(c.start) >= c.soft
+}
+
+// stop останавливает таймер после завершения поиска
+func (c *searchClock) stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+}
+
+// newSearch создает поток поиска в позиции board
+func (a *Agent) newSearch(board *game.Board, shared *sharedSearch) *search {
+	s := &search{
+		agent:   a,
+		shared:  shared,
+		board:   board.Clone(),
+		tt:      a.tt,
+		orderer: newMoveOrderer(),
+		input:   make([]float64, InputSize),
+	}
+	// Зашумленные оценки не должны попадать в другие поиски
+	if shared.noise > 0 {
+		s.keyMix = shared.noiseSeed
+	}
+	return s
+}
+
+// iterate - итеративное углубление вспомогательного потока. Его результаты
+// не возвращаются, а только заполняют таблицу транспозиций.
+func (s *search) iterate(startDepth, maxDepth int) {
+	for depth := startDepth; depth <= maxDepth; depth++ {
+		s.negamax(depth, 0, -math.MaxFloat64, math.MaxFloat64)
+		if s.aborted {
+			return
+		}
+	}
+}
+
+// visited возвращает количество позиций, просмотренных всеми потоками
+func (sh *sharedSearch) visited() uint64 {
+	return atomic.LoadUint64(&sh.nodes)
+}
+
+// evaluate оценивает позицию для стороны, которая делает ход. Нейросеть обучается
+// на позициях, записанных перед ходом, с очками сделавшей ход стороны (1 - победа,
+// 0.5 - ничья, 0 - поражение), поэтому ее выход - ожидаемые очки стороны, которая
+// делает ход. Для negamax они переводятся в симметричную оценку от -1 до 1.
+func (s *search) evaluate() float64 {
+	encodeBoard(s.board, s.input)
+	score := 2*s.agent.Network.Forward(s.input) - 1
+	if s.shared.noise > 0 {
+		score += noiseAt(s.board.Hash(), s.shared.noiseSeed, s.shared.noise)
+	}
+	return score
+}
+
+// checkAbort проверяет, не отменен ли поиск и не исчерпан ли лимит позиций
+func (s *search) checkAbort() bool {
+	if !s.aborted {
+		select {
+		case <-s.shared.done:
+			s.aborted = true
+		default:
+			s.aborted = s.shared.maxNodes > 0 && s.shared.visited() >= s.shared.maxNodes
+		}
+	}
+	return s.aborted
+}
+
+// countNode учитывает просмотренную позицию
+func (s *search) countNode() {
+	atomic.AddUint64(&s.shared.nodes, 1)
+}
+
+// negamax реализует поиск с альфа-бета отсечением в форме negamax: оценка всегда дается
+// для стороны, которая делает ход, а оценка хода - это оценка ответа со знаком минус.
+// ply - расстояние от корня. Главный вариант сохраняется в s.pv[ply].
+func (s *search) negamax(depth, ply int, alpha, beta float64) float64 {
+	s.pvLength[ply] = ply
+	if s.checkAbort() {
+		return 0
+	}
+
+	// На горизонте продолжаем форсированным вариантом, чтобы не оценивать позицию
+	// посреди размена
+	if depth == 0 {
+		return s.quiescence(ply, alpha, beta)
+	}
+	s.countNode()
+
+	board := s.board
+
+	// Оценка из таблицы подходит, если она найдена поиском не меньшей глубины и либо
+	// точна, либо уже выходит за окно. В корне поиск выполняется всегда.
+	key := board.Hash() ^ s.keyMix
+	ttMove := noMove
+	if entry, ok := s.tt.probe(key); ok {
+		ttMove = entry.move
+		if ply > 0 && entry.depth >= depth {
+			score := scoreFromTT(entry.score, ply)
+			switch {
+			case entry.bound == boundExact,
+				entry.bound == boundLower && score >= beta,
+				entry.bound == boundUpper && score <= alpha:
+				return score
+			}
+		}
+	}
+
+	// Корень ищется, даже если партию в нем уже можно закончить ничьей (правило
+	// 50 ходов, повторение): поиск должен вернуть ход
+	if board.GameOver && ply > 0 {
+		score := terminalScore(board, ply)
+		// Ничья повторением или по правилу 50 ходов зависит от истории ходов, а не
+		// только от позиции, поэтому в таблицу не записывается
+		if board.Termination != game.Repetition && board.Termination != game.FiftyMoveRule {
+			s.tt.store(key, ttEntry{depth: depth, score: scoreToTT(score, ply), bound: boundExact, move: noMove})
+		}
+		return score
+	}
+
+	moves := board.GetLegalMoves()
+	if len(moves) == 0 {
+		return terminalScore(board, ply)
+	}
+	s.orderer.orderMoves(board, moves, ttMove, ply)
+
+	alphaOrig := alpha
+	best := -math.MaxFloat64
+	bestMove := noMove
+	for _, move := range moves {
+		if ply == 0 && s.isExcluded(move) {
+			continue
+		}
+
+		board.MakeMove(move)
+		score := -s.negamax(depth-1, ply+1, -beta, -alpha)
+		board.UnmakeMove()
+		if s.aborted {
+			return 0
+		}
+
+		if score > best {
+			best = score
+			bestMove = move
+		}
+		if score > alpha {
+			alpha = score
+			s.updatePV(ply, move)
+		}
+		if alpha >= beta {
+			s.cutoff(move, depth, ply)
+			break // Альфа-бета отсечение
+		}
+	}
+
+	// Если ни один ход не улучшил alpha, главный вариант - лучший из худших ходов
+	if s.pvLength[ply] == ply {
+		s.pv[ply][ply] = bestMove
+		s.pvLength[ply] = ply + 1
+	}
+
+	// Оценка корня без части ходов не является оценкой позиции
+	if ply == 0 && len(s.excluded) > 0 {
+		return best
+	}
+
+	bound := boundExact
+	if best <= alphaOrig {
+		bound = boundUpper
+	} else if best >= beta {
+		bound = boundLower
+	}
+	s.tt.store(key, ttEntry{depth: depth, score: scoreToTT(best, ply), bound: bound, move: bestMove})
+	return best
+}
+
+// isExcluded проверяет, вошел ли ход в корне в один из уже найденных вариантов
+func (s *search) isExcluded(move game.Move) bool {
+	for _, excluded := range s.excluded {
+		if move == excluded {
+			return true
+		}
+	}
+	return false
+}
+
+// updatePV делает move началом главного варианта в позиции ply, продолжая его
+// главным вариантом ответа
+func (s *search) updatePV(ply int, move game.Move) {
+	s.pv[ply][ply] = move
+	next := ply + 1
+	if next > MaxSearchDepth {
+		s.pvLength[ply] = next
+		return
+	}
+	copy(s.pv[ply][next:], s.pv[next][next:s.pvLength[next]])
+	s.pvLength[ply] = s.pvLength[next]
+}
+
+// cutoff запоминает тихий ход, давший отсечение, для упорядочивания ходов
+func (s *search) cutoff(move game.Move, depth, ply int) {
+	if isQuiet(s.board, move) {
+		s.orderer.update(s.board.CurrentTurn, move, depth, ply)
+	}
+}
+
+// quiescence продолжает поиск за горизонтом только взятиями и превращениями, пока
+// позиция не станет спокойной. Сторона, которая делает ход, может отказаться от взятий
+// и согласиться со статической оценкой (stand-pat). Под шахом перебираются все ходы.
+// ply - расстояние от корня.
+func (s *search) quiescence(ply int, alpha, beta float64) float64 {
+	if s.checkAbort() {
+		return 0
+	}
+	s.countNode()
+
+	board := s.board
+	if board.GameOver {
+		return terminalScore(board, ply)
+	}
+
+	moves := board.GetLegalMoves()
+	if len(moves) == 0 {
+		return terminalScore(board, ply)
+	}
+	best := -math.MaxFloat64
+
+	if !board.IsCheck {
+		standPat := s.evaluate()
+		if standPat >= beta {
+			return standPat
+		}
+		alpha = math.Max(alpha, standPat)
+		best = standPat
+
+		tactical := moves[:0]
+		for _, move := range moves {
+			if !isQuiet(board, move) {
+				tactical = append(tactical, move)
+			}
+		}
+		moves = tactical
+	}
+	s.orderer.orderMoves(board, moves, noMove, -1)
+
+	for _, move := range moves {
+		board.MakeMove(move)
+		score := -s.quiescence(ply+1, -beta, -alpha)
+		board.UnmakeMove()
+		if s.aborted {
+			return 0
+		}
+
+		best = math.Max(best, score)
+		alpha = math.Max(alpha, score)
+		if alpha >= beta {
+			break
+		}
+	}
+	return best
+}
+
+// principalVariation возвращает главный вариант последней итерации. Если вариант
+// оборвался на позиции, оценка которой взята из таблицы транспозиций, он продолжается
+// лучшими ходами из таблицы.
+func (s *search) principalVariation(depth int) []game.Move {
+	pv := append([]game.Move(nil), s.pv[0][:s.pvLength[0]]...)
+
+	board := s.board.Clone()
+	for _, move := range pv {
+		board.MakeMove(move)
+	}
+	for len(pv) < depth && !board.GameOver {
+		entry, ok := s.tt.probe(board.Hash() ^ s.keyMix)
+		if !ok || entry.move.From.Row == -1 || !board.IsValidMove(entry.move) {
+			break
+		}
+		pv = append(pv, entry.move)
+		board.MakeMove(entry.move)
+	}
+	return pv
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
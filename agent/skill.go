@@ -0,0 +1,125 @@
+package agent
+
+import (
+	"math/rand"
+	"sync/atomic"
+)
+
+// Уровни силы игры: 0 - самый слабый, MaxSkillLevel - полная сила
+const (
+	MinSkillLevel = 0
+	MaxSkillLevel = 20
+
+	// Диапазон рейтинга для UCI_Elo: MinElo соответствует уровню 0, MaxElo - полной силе
+	MinElo = 800
+	MaxElo = 2400
+)
+
+// SetSkillLevel задает уровень силы игры (от MinSkillLevel до MaxSkillLevel). На неполной
+// силе агент ищет мельче, оценивает позиции с шумом и выбирает ход среди почти лучших.
+// Уровень силы не связан с Epsilon, которое задает случайные ходы для исследования при обучении.
+// Уровень можно менять во время поиска: он учитывается со следующего хода.
+func (a *Agent) SetSkillLevel(level int) {
+	if level < MinSkillLevel {
+		level = MinSkillLevel
+	}
+	if level > MaxSkillLevel {
+		level = MaxSkillLevel
+	}
+	atomic.StoreInt32(&a.skillLevel, int32(level))
+}
+
+// SkillLevel возвращает уровень силы игры
+func (a *Agent) SkillLevel() int {
+	return int(atomic.LoadInt32(&a.skillLevel))
+}
+
+// SkillLevelForElo переводит рейтинг в уровень силы. Шкала линейная: уровень
+// соответствует (MaxElo-MinElo)/MaxSkillLevel = 80 пунктам рейтинга. Шкала задана,
+// а не измерена матчами между уровнями, поэтому рейтинг приблизительный.
+func SkillLevelForElo(elo int) int {
+	if elo <= MinElo {
+		return MinSkillLevel
+	}
+	if elo >= MaxElo {
+		return MaxSkillLevel
+	}
+	return MinSkillLevel + (elo-MinElo)*(MaxSkillLevel-MinSkillLevel)/(MaxElo-MinElo)
+}
+
+// skillLimits ограничивает глубину и количество позиций поиска на уровне level
+func skillLimits(level int, limits SearchLimits) SearchLimits {
+	if level >= MaxSkillLevel {
+		return limits
+	}
+
+	depth := 1 + level/4
+	if limits.Depth == 0 || limits.Depth > depth {
+		limits.Depth = depth
+	}
+	nodes := uint64(500) << uint(level/2)
+	if limits.Nodes == 0 || limits.Nodes > nodes {
+		limits.Nodes = nodes
+	}
+	return limits
+}
+
+// skillCandidates возвращает, из скольких лучших ходов выбирается ход на уровне level
+func skillCandidates(level int) int {
+	return 1 + (MaxSkillLevel-level)/4
+}
+
+// skillNoise возвращает амплитуду шума, добавляемого к оценке позиции на уровне level
+// (в единицах оценки нейросети от -1 до 1)
+func skillNoise(level int) float64 {
+	return 0.015 * float64(MaxSkillLevel-level)
+}
+
+// skillMargin возвращает, насколько ход может быть хуже лучшего, чтобы его можно было выбрать
+func skillMargin(level int) float64 {
+	return 0.01 * float64(MaxSkillLevel-level)
+}
+
+// selectMove выбирает ход среди вариантов lines (по убыванию оценки) на уровне level:
+// на полной силе - лучший, иначе случайный среди почти лучших, и чем ход ближе
+// к лучшему, тем выше вероятность его выбрать
+func selectMove(level int, lines []SearchResult) SearchResult {
+	if level >= MaxSkillLevel || len(lines) == 1 {
+		return lines[0]
+	}
+
+	margin := skillMargin(level)
+	weights := make([]float64, len(lines))
+	total := 0.0
+	for i, line := range lines {
+		if w := margin - (lines[0].Score - line.Score); w > 0 {
+			weights[i] = w
+			total += w
+		}
+	}
+
+	r := rand.Float64() * total
+	for i, w := range weights {
+		if r < w {
+			return lines[i]
+		}
+		r -= w
+	}
+	return lines[0]
+}
+
+// noiseAt возвращает шум оценки позиции с ключом key: псевдослучайный, но одинаковый
+// для одной позиции в пределах поиска, чтобы оценки в таблице транспозиций и разных
+// потоках не противоречили друг другу. Распределение треугольное на [-amplitude, amplitude].
+func noiseAt(key, seed uint64, amplitude float64) float64 {
+	// Перемешивание splitmix64
+	x := key ^ seed
+	x += 0x9E3779B97F4A7C15
+	x = (x ^ x>>30) * 0xBF58476D1CE4E5B9
+	x = (x ^ x>>27) * 0x94D049BB133111EB
+	x ^= x >> 31
+
+	u1 := float64(x>>40) / (1 << 24)
+	u2 := float64(x&(1<<24-1)) / (1 << 24)
+	return (u1 + u2 - 1) * amplitude
+}
@@ -0,0 +1,122 @@
+package agent
+
+import (
+	"chess-ai/game"
+	"math"
+	"sync/atomic"
+)
+
+// DefaultHashSize - размер таблицы транспозиций по умолчанию в мегабайтах
+const DefaultHashSize = 16
+
+// Тип оценки в таблице транспозиций
+const (
+	boundExact = iota + 1 // Точная оценка
+	boundLower            // Оценка не меньше сохраненной (отсечение по beta)
+	boundUpper            // Оценка не больше сохраненной (ни один ход не улучшил alpha)
+)
+
+// ttEntry - запись таблицы транспозиций
+type ttEntry struct {
+	depth int
+	score float64
+	bound int
+	move  game.Move
+}
+
+// ttSlot - ячейка таблицы. Запись упакована в одно 64-битное слово data, а вместо
+// ключа хранится key ^ data: если два потока одновременно запишут ячейку, проверка
+// ключа при чтении отбросит смешанную запись, поэтому блокировки не нужны.
+type ttSlot struct {
+	check uint64
+	data  uint64
+}
+
+// transpositionTable - таблица транспозиций фиксированного размера с ключами Zobrist.
+// Размер - степень двойки, чтобы номер ячейки получался маской ключа.
+type transpositionTable struct {
+	slots []ttSlot
+	mask  uint64
+}
+
+// newTranspositionTable создает таблицу размером не больше mb мегабайт
+func newTranspositionTable(mb int) *transpositionTable {
+	if mb < 1 {
+		mb = 1
+	}
+	size := uint64(1)
+	for size*2*16 <= uint64(mb)<<20 {
+		size *= 2
+	}
+	return &transpositionTable{
+		slots: make([]ttSlot, size),
+		mask:  size - 1,
+	}
+}
+
+// clear удаляет все записи
+func (t *transpositionTable) clear() {
+	for i := range t.slots {
+		atomic.StoreUint64(&t.slots[i].data, 0)
+		atomic.StoreUint64(&t.slots[i].check, 0)
+	}
+}
+
+// probe ищет запись для позиции с ключом key
+func (t *transpositionTable) probe(key uint64) (ttEntry, bool) {
+	slot := &t.slots[key&t.mask]
+	data := atomic.LoadUint64(&slot.data)
+	if data == 0 || atomic.LoadUint64(&slot.check)^data != key {
+		return ttEntry{}, false
+	}
+	return unpackEntry(data), true
+}
+
+// store сохраняет запись. Запись о той же позиции, найденная более глубоким
+// поиском, заменяется только точной оценкой; запись о другой позиции заменяется всегда.
+func (t *transpositionTable) store(key uint64, entry ttEntry) {
+	slot := &t.slots[key&t.mask]
+	if old, ok := t.probe(key); ok && old.depth > entry.depth && entry.bound != boundExact {
+		return
+	}
+
+	data := packEntry(entry)
+	atomic.StoreUint64(&slot.data, data)
+	atomic.StoreUint64(&slot.check, key^data)
+}
+
+// Раскладка записи в 64-битном слове:
+// биты 0-31 - оценка (float32), 32-37 - откуда, 38-43 - куда, 44-46 - превращение,
+// 47-48 - тип оценки, 49-56 - глубина. Тип оценки не бывает нулевым, поэтому
+// непустая запись никогда не равна нулю.
+func packEntry(entry ttEntry) uint64 {
+	data := uint64(math.Float32bits(float32(entry.score)))
+	if entry.move.From.Row != -1 {
+		data |= uint64(entry.move.From.Row*8+entry.move.From.Col) << 32
+		data |= uint64(entry.move.To.Row*8+entry.move.To.Col) << 38
+		data |= uint64(entry.move.Promotion) << 44
+	}
+	data |= uint64(entry.bound) << 47
+	data |= uint64(entry.depth&0xFF) << 49
+	return data
+}
+
+func unpackEntry(data uint64) ttEntry {
+	entry := ttEntry{
+		score: float64(math.Float32frombits(uint32(data))),
+		bound: int(data >> 47 & 3),
+		depth: int(data >> 49 & 0xFF),
+		move:  noMove,
+	}
+
+	// Ход, у которого совпадают начальная и конечная клетки, означает отсутствие хода
+	from, to := int(data>>32&63), int(data>>38&63)
+	if from != to {
+		entry.move = game.Move{
+			From:      game.Position{Row: from / 8, Col: from % 8},
+			To:        game.Position{Row: to / 8, Col: to % 8},
+			Promotion: game.PieceType(data >> 44 & 7),
+		}
+	}
+	return entry
+}
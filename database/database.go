@@ -26,6 +26,7 @@ type MoveRecord struct {
 	ToRow        int
 	ToCol        int
 	Evaluation   float64
+	UCI          string // Ход в нотации UCI (например, "e2e4")
 	Result       string // "win", "loss", "draw", "ongoing"
 	BoardHash    string
 	CreatedAt    time.Time
@@ -101,7 +102,46 @@ func (d *Database) createTables() error {
 	CREATE INDEX IF NOT EXISTS idx_moves_result ON moves(result);
 	`
 
-	_, err := d.db.Exec(schema)
+	if _, err := d.db.Exec(schema); err != nil {
+		return err
+	}
+
+	// Колонки, добавленные после первой версии схемы
+	if err := d.ensureColumn("moves", "uci", "TEXT"); err != nil {
+		return err
+	}
+	return d.ensureColumn("games", "termination", "TEXT")
+}
+
+// ensureColumn добавляет колонку в существующую таблицу, если ее еще нет
+func (d *Database) ensureColumn(table, column, definition string) error {
+	rows, err := d.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			colType    string
+			notNull    int
+			defaultVal sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultVal, &primaryKey); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = d.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
 	return err
 }
 
@@ -118,10 +158,10 @@ func (d *Database) StartGame(whiteEpsilon, blackEpsilon float64) (int64, error)
 }
 
 // FinishGame обновляет информацию о завершенной игре
-func (d *Database) FinishGame(gameID int64, winner string, movesCount int) error {
+func (d *Database) FinishGame(gameID int64, winner, termination string, movesCount int) error {
 	_, err := d.db.Exec(
-		"UPDATE games SET finished_at = CURRENT_TIMESTAMP, winner = ?, moves_count = ? WHERE id = ?",
-		winner, movesCount, gameID,
+		"UPDATE games SET finished_at = CURRENT_TIMESTAMP, winner = ?, termination = ?, moves_count = ? WHERE id = ?",
+		winner, termination, movesCount, gameID,
 	)
 	return err
 }
@@ -129,10 +169,10 @@ func (d *Database) FinishGame(gameID int64, winner string, movesCount int) error
 // RecordMove записывает ход в базу данных
 func (d *Database) RecordMove(record MoveRecord) error {
 	_, err := d.db.Exec(`
-		INSERT INTO moves (game_id, move_number, from_row, from_col, to_row, to_col, evaluation, board_hash, result)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		INSERT INTO moves (game_id, move_number, from_row, from_col, to_row, to_col, evaluation, uci, board_hash, result)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		record.GameID, record.MoveNumber, record.FromRow, record.FromCol,
-		record.ToRow, record.ToCol, record.Evaluation, record.BoardHash, record.Result,
+		record.ToRow, record.ToCol, record.Evaluation, record.UCI, record.BoardHash, record.Result,
 	)
 	return err
 }
@@ -187,7 +227,7 @@ func (d *Database) GetSimilarMoves(boardHash string, limit int) ([]MoveRecord, e
 	}
 	
 	rows, err := d.db.Query(`
-		SELECT id, game_id, move_number, from_row, from_col, to_row, to_col, evaluation, result, board_hash, created_at
+		SELECT id, game_id, move_number, from_row, from_col, to_row, to_col, evaluation, COALESCE(uci, ''), result, board_hash, created_at
 		FROM moves
 		WHERE board_hash = ?
 		ORDER BY evaluation DESC
@@ -202,7 +242,7 @@ func (d *Database) GetSimilarMoves(boardHash string, limit int) ([]MoveRecord, e
 	for rows.Next() {
 		var r MoveRecord
 		err := rows.Scan(&r.ID, &r.GameID, &r.MoveNumber, &r.FromRow, &r.FromCol,
-			&r.ToRow, &r.ToCol, &r.Evaluation, &r.Result, &r.BoardHash, &r.CreatedAt)
+			&r.ToRow, &r.ToCol, &r.Evaluation, &r.UCI, &r.Result, &r.BoardHash, &r.CreatedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -221,6 +261,46 @@ func (d *Database) UpdateMoveResults(gameID int64, result string) error {
 	return err
 }
 
+// GameRecord - завершенная партия из базы данных со всеми ходами по порядку
+type GameRecord struct {
+	ID     int64
+	Winner string // "white", "black" или "draw"
+	Moves  []MoveRecord
+}
+
+// GetFinishedGames возвращает все завершенные партии с ходами
+func (d *Database) GetFinishedGames() ([]GameRecord, error) {
+	rows, err := d.db.Query(`
+		SELECT g.id, g.winner, m.move_number, m.from_row, m.from_col, m.to_row, m.to_col,
+			COALESCE(m.evaluation, 0), COALESCE(m.uci, ''), COALESCE(m.result, ''), COALESCE(m.board_hash, '')
+		FROM moves m
+		JOIN games g ON g.id = m.game_id
+		WHERE g.winner IN ('white', 'black', 'draw')
+		ORDER BY g.id, m.move_number
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var games []GameRecord
+	for rows.Next() {
+		var winner string
+		r := MoveRecord{}
+		err := rows.Scan(&r.GameID, &winner, &r.MoveNumber, &r.FromRow, &r.FromCol,
+			&r.ToRow, &r.ToCol, &r.Evaluation, &r.UCI, &r.Result, &r.BoardHash)
+		if err != nil {
+			return nil, err
+		}
+		if len(games) == 0 || games[len(games)-1].ID != r.GameID {
+			games = append(games, GameRecord{ID: r.GameID, Winner: winner})
+		}
+		last := &games[len(games)-1]
+		last.Moves = append(last.Moves, r)
+	}
+	return games, rows.Err()
+}
+
 // GetTotalGames возвращает общее количество игр в базе
 func (d *Database) GetTotalGames() (int, error) {
 	var count int
@@ -233,45 +313,23 @@ func (d *Database) Close() error {
 	return d.db.Close()
 }
 
-// GenerateBoardHash генерирует хеш для позиции на доске
-func GenerateBoardHash(board *game.Board) string {
-	hash := ""
-	for row := 0; row < 8; row++ {
-		for col := 0; col < 8; col++ {
-			piece := board.Cells[row][col]
-			if piece.Type == game.Empty {
-				hash += "."
-			} else {
-				symbol := pieceToChar(piece)
-				hash += string(symbol)
-			}
+// IsZobristHash сообщает, записан ли ключ позиции в формате GenerateBoardHash.
+// В старых записях board_hash хранится в прежнем формате - строкой расстановки фигур.
+func IsZobristHash(hash string) bool {
+	if len(hash) != 16 {
+		return false
+	}
+	for _, c := range hash {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
 		}
 	}
-	return hash
+	return true
 }
 
-// pieceToChar преобразует фигуру в символ
-func pieceToChar(piece game.Piece) rune {
-	var char rune
-	switch piece.Type {
-	case game.Pawn:
-		char = 'p'
-	case game.Knight:
-		char = 'n'
-	case game.Bishop:
-		char = 'b'
-	case game.Rook:
-		char = 'r'
-	case game.Queen:
-		char = 'q'
-	case game.King:
-		char = 'k'
-	default:
-		char = '.'
-	}
-
-	if piece.Color == game.White {
-		return char - 32 // Преобразуем в заглавную букву
-	}
-	return char
+// GenerateBoardHash возвращает ключ позиции для столбца board_hash - ключ Zobrist
+// в шестнадцатеричном виде. В отличие от одной расстановки фигур он различает
+// очередь хода, права на рокировку и возможность взятия на проходе.
+func GenerateBoardHash(board *game.Board) string {
+	return fmt.Sprintf("%016x", board.Hash())
 }
@@ -0,0 +1,223 @@
+package game
+
+import "math/bits"
+
+// bitboard - множество клеток доски, по одному биту на клетку.
+// Нумерация клеток: a1 = 0, b1 = 1, ..., h8 = 63.
+type bitboard uint64
+
+const (
+	fileA bitboard = 0x0101010101010101
+	fileH bitboard = fileA << 7
+	rank1 bitboard = 0xFF
+	rank3 bitboard = rank1 << 16
+	rank6 bitboard = rank1 << 40
+	rank8 bitboard = rank1 << 56
+)
+
+// Направления движения дальнобойных фигур (горизонталь, вертикаль)
+var (
+	rookDirections   = [4][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}}
+	bishopDirections = [4][2]int{{1, 1}, {1, -1}, {-1, 1}, {-1, -1}}
+)
+
+// Таблицы атак, вычисляемые при инициализации пакета
+var (
+	knightAttacks [64]bitboard
+	kingAttacks   [64]bitboard
+	pawnAttacks   [2][64]bitboard // Клетки, которые бьет пешка указанного цвета
+
+	rookMagics   [64]magicEntry
+	bishopMagics [64]magicEntry
+)
+
+// magicEntry - "магическая" таблица атак дальнобойной фигуры с одной клетки.
+// Индекс в таблице получается умножением значимых блокирующих фигур на магическое число.
+type magicEntry struct {
+	mask    bitboard // Клетки, фигуры на которых могут ограничить атаку (без краев доски)
+	magic   uint64
+	shift   uint
+	attacks []bitboard
+}
+
+// squareIndex преобразует позицию на доске в номер клетки
+func squareIndex(pos Position) int {
+	return (7-pos.Row)*8 + pos.Col
+}
+
+// squarePosition преобразует номер клетки в позицию на доске
+func squarePosition(sq int) Position {
+	return Position{Row: 7 - sq/8, Col: sq % 8}
+}
+
+// squareBB возвращает битборд из одной клетки
+func squareBB(sq int) bitboard {
+	return 1 << uint(sq)
+}
+
+// lsb возвращает номер младшей установленной клетки
+func (bb bitboard) lsb() int {
+	return bits.TrailingZeros64(uint64(bb))
+}
+
+// count возвращает количество клеток в множестве
+func (bb bitboard) count() int {
+	return bits.OnesCount64(uint64(bb))
+}
+
+// rookAttacks возвращает клетки, атакуемые ладьей с клетки sq при занятости occ
+func rookAttacks(sq int, occ bitboard) bitboard {
+	m := &rookMagics[sq]
+	return m.attacks[uint64(occ&m.mask)*m.magic>>m.shift]
+}
+
+// bishopAttacks возвращает клетки, атакуемые слоном с клетки sq при занятости occ
+func bishopAttacks(sq int, occ bitboard) bitboard {
+	m := &bishopMagics[sq]
+	return m.attacks[uint64(occ&m.mask)*m.magic>>m.shift]
+}
+
+// pieceAttacks возвращает клетки, атакуемые фигурой (кроме пешки) с клетки sq
+func pieceAttacks(pieceType PieceType, sq int, occ bitboard) bitboard {
+	switch pieceType {
+	case Knight:
+		return knightAttacks[sq]
+	case Bishop:
+		return bishopAttacks(sq, occ)
+	case Rook:
+		return rookAttacks(sq, occ)
+	case Queen:
+		return bishopAttacks(sq, occ) | rookAttacks(sq, occ)
+	case King:
+		return kingAttacks[sq]
+	}
+	return 0
+}
+
+func init() {
+	initLeaperAttacks()
+
+	for sq := 0; sq < 64; sq++ {
+		rookMagics[sq].init(sq, rookDirections)
+		bishopMagics[sq].init(sq, bishopDirections)
+	}
+}
+
+// magicSeeds - начальные значения генератора для каждой горизонтали, при которых
+// подбор магических чисел сходится быстро (те же, что использует Stockfish)
+var magicSeeds = [8]uint64{728, 10316, 55013, 32803, 12281, 15100, 16645, 255}
+
+// initLeaperAttacks заполняет таблицы атак коня, короля и пешек
+func initLeaperAttacks() {
+	knightSteps := [][2]int{{1, 2}, {2, 1}, {2, -1}, {1, -2}, {-1, -2}, {-2, -1}, {-2, 1}, {-1, 2}}
+	kingSteps := [][2]int{{1, 0}, {1, 1}, {0, 1}, {-1, 1}, {-1, 0}, {-1, -1}, {0, -1}, {1, -1}}
+
+	for sq := 0; sq < 64; sq++ {
+		knightAttacks[sq] = stepAttacks(sq, knightSteps)
+		kingAttacks[sq] = stepAttacks(sq, kingSteps)
+		pawnAttacks[White][sq] = stepAttacks(sq, [][2]int{{1, -1}, {1, 1}})
+		pawnAttacks[Black][sq] = stepAttacks(sq, [][2]int{{-1, -1}, {-1, 1}})
+	}
+}
+
+// stepAttacks возвращает клетки, достижимые с клетки sq одним шагом из steps
+func stepAttacks(sq int, steps [][2]int) bitboard {
+	var bb bitboard
+	rank, file := sq/8, sq%8
+	for _, step := range steps {
+		r, f := rank+step[0], file+step[1]
+		if r >= 0 && r < 8 && f >= 0 && f < 8 {
+			bb |= squareBB(r*8 + f)
+		}
+	}
+	return bb
+}
+
+// slidingAttacks вычисляет атаки дальнобойной фигуры перебором лучей.
+// Используется только для построения магических таблиц.
+func slidingAttacks(sq int, occ bitboard, directions [4][2]int) bitboard {
+	var bb bitboard
+	for _, dir := range directions {
+		r, f := sq/8+dir[0], sq%8+dir[1]
+		for r >= 0 && r < 8 && f >= 0 && f < 8 {
+			target := squareBB(r*8 + f)
+			bb |= target
+			if occ&target != 0 {
+				break
+			}
+			r += dir[0]
+			f += dir[1]
+		}
+	}
+	return bb
+}
+
+// init подбирает магическое число для клетки sq и заполняет таблицу атак
+func (m *magicEntry) init(sq int, directions [4][2]int) {
+	// Фигуры на краю доски не влияют на атаку, поэтому исключаем края
+	// (кроме горизонтали и вертикали, на которых стоит сама фигура)
+	edges := ((rank1 | rank8) &^ (rank1 << uint(8*(sq/8)))) |
+		((fileA | fileH) &^ (fileA << uint(sq%8)))
+	m.mask = slidingAttacks(sq, 0, directions) &^ edges
+	m.shift = uint(64 - m.mask.count())
+
+	// Перебираем все подмножества маски (метод Carry-Rippler)
+	size := 1 << uint(m.mask.count())
+	occupancies := make([]bitboard, 0, size)
+	reference := make([]bitboard, 0, size)
+	var occ bitboard
+	for {
+		occupancies = append(occupancies, occ)
+		reference = append(reference, slidingAttacks(sq, occ, directions))
+		occ = (occ - m.mask) & m.mask
+		if occ == 0 {
+			break
+		}
+	}
+
+	// Ищем число без коллизий с разными атаками
+	rng := magicRand{state: magicSeeds[sq/8]}
+	m.attacks = make([]bitboard, size)
+	epoch := make([]int, size)
+	for attempt := 1; ; attempt++ {
+		magic := rng.sparse()
+		if bits.OnesCount64(uint64(m.mask)*magic>>56) < 6 {
+			continue
+		}
+
+		ok := true
+		for i, occ := range occupancies {
+			idx := uint64(occ) * magic >> m.shift
+			if epoch[idx] != attempt {
+				epoch[idx] = attempt
+				m.attacks[idx] = reference[i]
+			} else if m.attacks[idx] != reference[i] {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			m.magic = magic
+			return
+		}
+	}
+}
+
+// magicRand - генератор псевдослучайных чисел (xorshift64*) для подбора магических чисел.
+// Фиксированные начальные значения делают таблицы одинаковыми при каждом запуске.
+type magicRand struct {
+	state uint64
+}
+
+func (r *magicRand) next() uint64 {
+	r.state ^= r.state >> 12
+	r.state ^= r.state << 25
+	r.state ^= r.state >> 27
+	return r.state * 2685821657736338717
+}
+
+// sparse возвращает число с небольшим количеством единичных битов - такие
+// числа гораздо чаще оказываются подходящими магическими числами
+func (r *magicRand) sparse() uint64 {
+	return r.next() & r.next() & r.next()
+}
@@ -39,33 +39,76 @@ type Piece struct {
 
 // Ход
 type Move struct {
-	From Position
-	To   Position
+	From      Position
+	To        Position
+	Promotion PieceType // Фигура для превращения пешки (Empty - ферзь по умолчанию)
 }
 
+// PromotionPieces - фигуры, в которые может превратиться пешка
+var PromotionPieces = []PieceType{Queen, Rook, Bishop, Knight}
+
 // Доска
 type Board struct {
 	Cells           [8][8]Piece
 	CurrentTurn     Color
 	GameOver        bool
-	Winner          Color
-	IsCheck         bool      // Находится ли текущий игрок под шахом
-	EnPassantTarget *Position // Позиция для взятия на проходе
+	Result          Result      // Результат партии (Ongoing, пока игра не окончена)
+	Termination     Termination // Причина окончания партии
+	IsCheck         bool        // Находится ли текущий игрок под шахом
+	EnPassantTarget *Position   // Позиция для взятия на проходе
 	WhiteKingMoved  bool
 	BlackKingMoved  bool
 	WhiteRookAMoved bool
 	WhiteRookHMoved bool
 	BlackRookAMoved bool
 	BlackRookHMoved bool
-	MovesCount      int
+	MovesCount      int  // Количество сделанных полуходов
+	HalfMoveClock   int  // Полуходы с последнего взятия или хода пешкой
+	ClaimDraws      bool // Засчитывать ничью при троекратном повторении и по правилу 50 ходов без заявления
+
+	// Ключ Zobrist текущей позиции
+	hash uint64
+
+	// Ключи всех позиций партии и индекс первой позиции после последнего
+	// необратимого хода (для определения повторений)
+	positionHistory []uint64
+	repetitionStart int
+
+	// Стек для отмены ходов
+	undoStack []undoInfo
+}
+
+// undoInfo - состояние доски перед ходом, необходимое для его отмены
+type undoInfo struct {
+	move            Move
+	piece           Piece    // Сходившая фигура (пешка при превращении)
+	captured        Piece    // Взятая фигура (Empty, если взятия не было)
+	capturedAt      Position // Клетка взятой фигуры (при взятии на проходе не совпадает с move.To)
+	enPassantTarget *Position
+	whiteKingMoved  bool
+	blackKingMoved  bool
+	whiteRookAMoved bool
+	whiteRookHMoved bool
+	blackRookAMoved bool
+	blackRookHMoved bool
+	halfMoveClock   int
+	repetitionStart int
+	hash            uint64
+	isCheck         bool
+	gameOver        bool
+	result          Result
+	termination     Termination
 }
 
 // NewBoard создает новую доску с начальной позицией
 func NewBoard() *Board {
 	board := &Board{
 		CurrentTurn: White,
+		ClaimDraws:  true,
 	}
 	board.setupInitialPosition()
+	board.hash = board.ComputeHash()
+	board.positionHistory = []uint64{board.hash}
 	return board
 }
 
@@ -145,6 +188,18 @@ func (b *Board) IsValidMove(move Move) bool {
 		return false
 	}
 
+	// Фигуру превращения можно указывать только для пешки на последней горизонтали
+	if move.Promotion != Empty {
+		if !isPromotionMove(move, piece) {
+			return false
+		}
+		switch move.Promotion {
+		case Queen, Rook, Bishop, Knight:
+		default:
+			return false
+		}
+	}
+
 	// Проверяем, не оставляет ли ход короля под шахом
 	return !b.wouldBeInCheck(move, piece.Color)
 }
@@ -356,43 +411,83 @@ func (b *Board) isPathClear(move Move) bool {
 
 // MakeMove выполняет ход
 func (b *Board) MakeMove(move Move) {
+	b.applyMove(move)
+
+	// Проверяем, находится ли текущий игрок под шахом
+	b.IsCheck = b.isInCheck(b.CurrentTurn)
+
+	// Проверяем окончание игры
+	b.checkGameOver()
+}
+
+// applyMove выполняет ход без проверки шаха и окончания игры
+func (b *Board) applyMove(move Move) {
 	piece := b.Cells[move.From.Row][move.From.Col]
-	
+	captured := b.Cells[move.To.Row][move.To.Col]
+
+	// Запоминаем состояние для UnmakeMove
+	undo := undoInfo{
+		move:            move,
+		piece:           piece,
+		captured:        captured,
+		capturedAt:      move.To,
+		enPassantTarget: b.EnPassantTarget,
+		whiteKingMoved:  b.WhiteKingMoved,
+		blackKingMoved:  b.BlackKingMoved,
+		whiteRookAMoved: b.WhiteRookAMoved,
+		whiteRookHMoved: b.WhiteRookHMoved,
+		blackRookAMoved: b.BlackRookAMoved,
+		blackRookHMoved: b.BlackRookHMoved,
+		halfMoveClock:   b.HalfMoveClock,
+		repetitionStart: b.repetitionStart,
+		hash:            b.hash,
+		isCheck:         b.IsCheck,
+		gameOver:        b.GameOver,
+		result:          b.Result,
+		termination:     b.Termination,
+	}
+
+	// Убираем из ключа очередь хода, права на рокировку и взятие на проходе,
+	// после хода добавим их новые значения
+	b.hash ^= b.stateHash()
+
 	if piece.Type == Pawn && b.EnPassantTarget != nil &&
 		move.To.Row == b.EnPassantTarget.Row && move.To.Col == b.EnPassantTarget.Col {
-		if piece.Color == White {
-			b.Cells[move.To.Row+1][move.To.Col] = Piece{Empty, White}
-		} else {
-			b.Cells[move.To.Row-1][move.To.Col] = Piece{Empty, White}
-		}
+		undo.capturedAt = Position{Row: move.From.Row, Col: move.To.Col}
+		captured = b.Cells[undo.capturedAt.Row][undo.capturedAt.Col]
+		b.Cells[undo.capturedAt.Row][undo.capturedAt.Col] = Piece{Empty, White}
 	}
+	undo.captured = captured
+	b.togglePiece(captured, undo.capturedAt)
 
 	// Рокировка
 	if piece.Type == King && abs(move.To.Col-move.From.Col) == 2 {
 		// Перемещаем ладью
-		isKingSide := move.To.Col > move.From.Col
-		if isKingSide {
+		rookFrom := Position{Row: move.From.Row, Col: 0}
+		rookTo := Position{Row: move.From.Row, Col: 3}
+		if move.To.Col > move.From.Col {
 			// Короткая рокировка
-			b.Cells[move.From.Row][5] = b.Cells[move.From.Row][7]
-			b.Cells[move.From.Row][7] = Piece{Empty, White}
-		} else {
-			// Длинная рокировка
-			b.Cells[move.From.Row][3] = b.Cells[move.From.Row][0]
-			b.Cells[move.From.Row][0] = Piece{Empty, White}
+			rookFrom.Col, rookTo.Col = 7, 5
 		}
-	}
-
-	// Обычное перемещение фигуры
-	b.Cells[move.To.Row][move.To.Col] = piece
-	b.Cells[move.From.Row][move.From.Col] = Piece{Empty, White}
-
-	// Превращение пешки
-	if piece.Type == Pawn {
-		if (piece.Color == White && move.To.Row == 0) ||
-			(piece.Color == Black && move.To.Row == 7) {
-			b.Cells[move.To.Row][move.To.Col] = Piece{Queen, piece.Color}
+		rook := b.Cells[rookFrom.Row][rookFrom.Col]
+		b.Cells[rookTo.Row][rookTo.Col] = rook
+		b.Cells[rookFrom.Row][rookFrom.Col] = Piece{Empty, White}
+		b.togglePiece(rook, rookFrom)
+		b.togglePiece(rook, rookTo)
+	}
+
+	// Обычное перемещение фигуры (при превращении пешка заменяется выбранной фигурой)
+	moved := piece
+	if isPromotionMove(move, piece) {
+		moved.Type = move.Promotion
+		if moved.Type == Empty {
+			moved.Type = Queen
 		}
 	}
+	b.Cells[move.To.Row][move.To.Col] = moved
+	b.Cells[move.From.Row][move.From.Col] = Piece{Empty, White}
+	b.togglePiece(piece, move.From)
+	b.togglePiece(moved, move.To)
 
 	// Обновляем флаг взятия на проходе
 	b.EnPassantTarget = nil
@@ -401,7 +496,8 @@ func (b *Board) MakeMove(move Move) {
 		b.EnPassantTarget = &Position{Row: epRow, Col: move.To.Col}
 	}
 
-	// Обновляем флаги движения короля и ладей
+	// Обновляем флаги движения короля и ладей: ход с исходной клетки
+	// или взятие ладьи на ее исходной клетке лишает права на рокировку
 	if piece.Type == King {
 		if piece.Color == White {
 			b.WhiteKingMoved = true
@@ -409,21 +505,8 @@ func (b *Board) MakeMove(move Move) {
 			b.BlackKingMoved = true
 		}
 	}
-	if piece.Type == Rook {
-		if piece.Color == White {
-			if move.From.Col == 0 {
-				b.WhiteRookAMoved = true
-			} else if move.From.Col == 7 {
-				b.WhiteRookHMoved = true
-			}
-		} else {
-			if move.From.Col == 0 {
-				b.BlackRookAMoved = true
-			} else if move.From.Col == 7 {
-				b.BlackRookHMoved = true
-			}
-		}
-	}
+	b.updateRookFlags(move.From)
+	b.updateRookFlags(move.To)
 
 	// Меняем ход
 	if b.CurrentTurn == White {
@@ -434,15 +517,111 @@ func (b *Board) MakeMove(move Move) {
 
 	b.MovesCount++
 
-	// Проверяем, находится ли текущий игрок под шахом
-	b.IsCheck = b.isInCheck(b.CurrentTurn)
+	// Обновляем счетчик полуходов (сбрасывается при ходе пешкой или взятии)
+	if piece.Type == Pawn || captured.Type != Empty {
+		b.HalfMoveClock = 0
+		// Позиции до необратимого хода больше не могут повториться
+		b.repetitionStart = len(b.positionHistory)
+	} else {
+		b.HalfMoveClock++
+	}
+	b.hash ^= b.stateHash()
+	b.positionHistory = append(b.positionHistory, b.hash)
+	b.undoStack = append(b.undoStack, undo)
+}
 
-	// Проверяем окончание игры
-	b.checkGameOver()
+// UnmakeMove отменяет последний сделанный ход и восстанавливает состояние доски
+// (включая результат партии). Возвращает false, если отменять нечего.
+func (b *Board) UnmakeMove() bool {
+	if len(b.undoStack) == 0 {
+		return false
+	}
+	undo := b.undoStack[len(b.undoStack)-1]
+	b.undoStack = b.undoStack[:len(b.undoStack)-1]
+	move := undo.move
+
+	// Возвращаем фигуру (при превращении - пешку) и взятую фигуру
+	b.Cells[move.From.Row][move.From.Col] = undo.piece
+	b.Cells[move.To.Row][move.To.Col] = Piece{Empty, White}
+	b.Cells[undo.capturedAt.Row][undo.capturedAt.Col] = undo.captured
+
+	// При рокировке возвращаем ладью
+	if undo.piece.Type == King && abs(move.To.Col-move.From.Col) == 2 {
+		rookFrom, rookTo := 0, 3
+		if move.To.Col > move.From.Col {
+			rookFrom, rookTo = 7, 5
+		}
+		b.Cells[move.From.Row][rookFrom] = b.Cells[move.From.Row][rookTo]
+		b.Cells[move.From.Row][rookTo] = Piece{Empty, White}
+	}
+
+	b.CurrentTurn = undo.piece.Color
+	b.MovesCount--
+	b.EnPassantTarget = undo.enPassantTarget
+	b.WhiteKingMoved = undo.whiteKingMoved
+	b.BlackKingMoved = undo.blackKingMoved
+	b.WhiteRookAMoved = undo.whiteRookAMoved
+	b.WhiteRookHMoved = undo.whiteRookHMoved
+	b.BlackRookAMoved = undo.blackRookAMoved
+	b.BlackRookHMoved = undo.blackRookHMoved
+	b.HalfMoveClock = undo.halfMoveClock
+	b.repetitionStart = undo.repetitionStart
+	b.hash = undo.hash
+	b.positionHistory = b.positionHistory[:len(b.positionHistory)-1]
+	b.IsCheck = undo.isCheck
+	b.GameOver = undo.gameOver
+	b.Result = undo.result
+	b.Termination = undo.termination
+
+	return true
+}
+
+// CanUnmakeMove проверяет, есть ли ход, который можно отменить
+func (b *Board) CanUnmakeMove() bool {
+	return len(b.undoStack) > 0
+}
+
+// updateRookFlags отмечает, что ладья покинула исходную клетку pos (или была там взята)
+func (b *Board) updateRookFlags(pos Position) {
+	switch pos {
+	case Position{Row: 7, Col: 0}:
+		b.WhiteRookAMoved = true
+	case Position{Row: 7, Col: 7}:
+		b.WhiteRookHMoved = true
+	case Position{Row: 0, Col: 0}:
+		b.BlackRookAMoved = true
+	case Position{Row: 0, Col: 7}:
+		b.BlackRookHMoved = true
+	}
 }
 
 // GetLegalMoves возвращает список всех легальных ходов для текущего игрока
 func (b *Board) GetLegalMoves() []Move {
+	p := b.bitPosition()
+	return p.legalMoves(make([]Move, 0, 48))
+}
+
+// CapturedPiece возвращает фигуру, которую берет ход (с учетом взятия на проходе),
+// или пустую клетку, если ход не является взятием
+func (b *Board) CapturedPiece(move Move) Piece {
+	if target := b.Cells[move.To.Row][move.To.Col]; target.Type != Empty {
+		return target
+	}
+	piece := b.Cells[move.From.Row][move.From.Col]
+	if piece.Type == Pawn && move.From.Col != move.To.Col {
+		return b.Cells[move.From.Row][move.To.Col]
+	}
+	return Piece{}
+}
+
+// IsPromotion проверяет, является ли ход превращением пешки
+func (b *Board) IsPromotion(move Move) bool {
+	return b.Cells[move.From.Row][move.From.Col].Type == Pawn && (move.To.Row == 0 || move.To.Row == 7)
+}
+
+// legalMovesScan - эталонный генератор ходов: перебирает все пары клеток и проверяет
+// каждую через IsValidMove. Медленный, используется для сверки с генератором на битбордах.
+func (b *Board) legalMovesScan() []Move {
 	moves := []Move{}
 
 	for row := 0; row < 8; row++ {
@@ -460,9 +639,19 @@ func (b *Board) GetLegalMoves() []Move {
 					to := Position{Row: toRow, Col: toCol}
 					move := Move{From: from, To: to}
 
-					if b.IsValidMove(move) {
-						moves = append(moves, move)
+					if !b.IsValidMove(move) {
+						continue
 					}
+
+					// Для превращения пешки генерируем ход для каждой фигуры
+					if isPromotionMove(move, piece) {
+						for _, promotion := range PromotionPieces {
+							move.Promotion = promotion
+							moves = append(moves, move)
+						}
+						continue
+					}
+					moves = append(moves, move)
 				}
 			}
 		}
@@ -547,32 +736,43 @@ func (b *Board) isSquareUnderAttack(pos Position, byColor Color) bool {
 
 // isInCheck проверяет, находится ли король указанного цвета под шахом
 func (b *Board) isInCheck(color Color) bool {
-	kingPos := b.findKing(color)
-	if kingPos.Row == -1 {
-		return false
-	}
-
-	// Определяем цвет противника
-	opponentColor := Black
-	if color == Black {
-		opponentColor = White
-	}
-
-	return b.isSquareUnderAttack(kingPos, opponentColor)
+	p := b.bitPosition()
+	return p.inCheck(color)
 }
 
 // wouldBeInCheck проверяет, будет ли король под шахом после хода
 func (b *Board) wouldBeInCheck(move Move, color Color) bool {
-	// Создаём временную копию доски
-	tempBoard := b.Clone()
+	// Создаём временную копию доски (для проверки шаха достаточно расстановки фигур)
+	tempBoard := &Board{Cells: b.Cells}
 
 	// Выполняем ход на временной доске
 	piece := tempBoard.Cells[move.From.Row][move.From.Col]
+
+	// При взятии на проходе снимаем побитую пешку: она может закрывать линию атаки на короля
+	if piece.Type == Pawn && move.From.Col != move.To.Col &&
+		tempBoard.Cells[move.To.Row][move.To.Col].Type == Empty {
+		tempBoard.Cells[move.From.Row][move.To.Col] = Piece{Empty, White}
+	}
+
+	// При рокировке переносим и ладью
+	if piece.Type == King && abs(move.To.Col-move.From.Col) == 2 {
+		rookFrom, rookTo := 0, 3
+		if move.To.Col > move.From.Col {
+			rookFrom, rookTo = 7, 5
+		}
+		tempBoard.Cells[move.From.Row][rookTo] = tempBoard.Cells[move.From.Row][rookFrom]
+		tempBoard.Cells[move.From.Row][rookFrom] = Piece{Empty, White}
+	}
+
 	tempBoard.Cells[move.To.Row][move.To.Col] = piece
 	tempBoard.Cells[move.From.Row][move.From.Col] = Piece{Empty, White}
 
-	// Проверяем, под шахом ли король
-	return tempBoard.isInCheck(color)
+	// Проверяем, под шахом ли король (перебором, независимо от битбордов)
+	kingPos := tempBoard.findKing(color)
+	if kingPos.Row == -1 {
+		return false
+	}
+	return tempBoard.isSquareUnderAttack(kingPos, opponent(color))
 }
 
 // checkGameOver проверяет окончание игры
@@ -580,25 +780,28 @@ func (b *Board) checkGameOver() {
 	moves := b.GetLegalMoves()
 	
 	if len(moves) == 0 {
-		b.GameOver = true
 		// Проверяем, находится ли король под шахом
 		if b.isInCheck(b.CurrentTurn) {
 			// Мат - противоположная сторона выигрывает
-			if b.CurrentTurn == White {
-				b.Winner = Black
-			} else {
-				b.Winner = White
-			}
+			b.endGame(WinFor(opponent(b.CurrentTurn)), Checkmate)
 		} else {
-			// Пат - ничья (используем White как индикатор ничьей)
-			b.Winner = White
+			b.endGame(Draw, Stalemate)
 		}
-	}
-
-	// Проверка на ничью по количеству ходов (упрощенная)
-	if b.MovesCount > 200 {
-		b.GameOver = true
-		b.Winner = White // Ничья
+		return
+	}
+
+	// Ничьи по правилам FIDE
+	switch {
+	case b.IsInsufficientMaterial():
+		b.endGame(Draw, InsufficientMaterial)
+	case b.IsFivefoldRepetition():
+		b.endGame(Draw, Repetition)
+	case b.IsSeventyFiveMoveRule():
+		b.endGame(Draw, FiftyMoveRule)
+	case b.ClaimDraws && b.IsThreefoldRepetition():
+		b.endGame(Draw, Repetition)
+	case b.ClaimDraws && b.IsFiftyMoveRule():
+		b.endGame(Draw, FiftyMoveRule)
 	}
 }
 
@@ -608,7 +811,8 @@ func (b *Board) Clone() *Board {
 		Cells:           b.Cells,
 		CurrentTurn:     b.CurrentTurn,
 		GameOver:        b.GameOver,
-		Winner:          b.Winner,
+		Result:          b.Result,
+		Termination:     b.Termination,
 		IsCheck:         b.IsCheck,
 		WhiteKingMoved:  b.WhiteKingMoved,
 		BlackKingMoved:  b.BlackKingMoved,
@@ -617,6 +821,12 @@ func (b *Board) Clone() *Board {
 		BlackRookAMoved: b.BlackRookAMoved,
 		BlackRookHMoved: b.BlackRookHMoved,
 		MovesCount:      b.MovesCount,
+		HalfMoveClock:   b.HalfMoveClock,
+		ClaimDraws:      b.ClaimDraws,
+		hash:            b.hash,
+		positionHistory: append([]uint64(nil), b.positionHistory...),
+		repetitionStart: b.repetitionStart,
+		undoStack:       append([]undoInfo(nil), b.undoStack...),
 	}
 
 	if b.EnPassantTarget != nil {
@@ -670,7 +880,23 @@ func pieceToString(piece Piece) string {
 	return symbol
 }
 
+// isPromotionMove проверяет, выходит ли пешка на последнюю горизонталь
+func isPromotionMove(move Move, piece Piece) bool {
+	if piece.Type != Pawn {
+		return false
+	}
+	return (piece.Color == White && move.To.Row == 0) ||
+		(piece.Color == Black && move.To.Row == 7)
+}
+
 // Вспомогательные функции
+func opponent(c Color) Color {
+	if c == White {
+		return Black
+	}
+	return White
+}
+
 func abs(x int) int {
 	if x < 0 {
 		return -x
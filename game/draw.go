@@ -0,0 +1,112 @@
+package game
+
+// canCaptureEnPassant проверяет, стоит ли рядом с пешкой, сделавшей двойной ход,
+// пешка противника. Поле взятия на проходе отличает позиции только в этом случае.
+func (b *Board) canCaptureEnPassant() bool {
+	if b.EnPassantTarget == nil {
+		return false
+	}
+	row := b.EnPassantTarget.Row + 1
+	if b.CurrentTurn == Black {
+		row = b.EnPassantTarget.Row - 1
+	}
+	if row < 0 || row > 7 {
+		return false
+	}
+	for _, col := range []int{b.EnPassantTarget.Col - 1, b.EnPassantTarget.Col + 1} {
+		if col >= 0 && col <= 7 && b.Cells[row][col] == (Piece{Pawn, b.CurrentTurn}) {
+			return true
+		}
+	}
+	return false
+}
+
+// RepetitionCount возвращает, сколько раз текущая позиция встречалась в партии
+func (b *Board) RepetitionCount() int {
+	if len(b.positionHistory) == 0 {
+		return 1
+	}
+	current := b.positionHistory[len(b.positionHistory)-1]
+	count := 0
+	for _, key := range b.positionHistory[b.repetitionStart:] {
+		if key == current {
+			count++
+		}
+	}
+	return count
+}
+
+// IsThreefoldRepetition проверяет троекратное повторение позиции (ничья по заявлению)
+func (b *Board) IsThreefoldRepetition() bool {
+	return b.RepetitionCount() >= 3
+}
+
+// IsFivefoldRepetition проверяет пятикратное повторение позиции (автоматическая ничья)
+func (b *Board) IsFivefoldRepetition() bool {
+	return b.RepetitionCount() >= 5
+}
+
+// IsFiftyMoveRule проверяет правило 50 ходов (ничья по заявлению)
+func (b *Board) IsFiftyMoveRule() bool {
+	return b.HalfMoveClock >= 100
+}
+
+// IsSeventyFiveMoveRule проверяет правило 75 ходов (автоматическая ничья)
+func (b *Board) IsSeventyFiveMoveRule() bool {
+	return b.HalfMoveClock >= 150
+}
+
+// IsInsufficientMaterial проверяет, что ни одна сторона не может поставить мат:
+// король против короля, король и легкая фигура против короля,
+// короли и слоны, стоящие на полях одного цвета
+func (b *Board) IsInsufficientMaterial() bool {
+	knights := 0
+	bishops := 0
+	bishopSquareColors := [2]bool{}
+
+	for row := 0; row < 8; row++ {
+		for col := 0; col < 8; col++ {
+			switch b.Cells[row][col].Type {
+			case Pawn, Rook, Queen:
+				return false
+			case Knight:
+				knights++
+			case Bishop:
+				bishops++
+				bishopSquareColors[(row+col)%2] = true
+			}
+		}
+	}
+
+	switch {
+	case knights == 0 && bishops == 0:
+		return true
+	case knights == 1 && bishops == 0:
+		return true
+	case knights == 0:
+		// Все слоны на полях одного цвета
+		return !(bishopSquareColors[0] && bishopSquareColors[1])
+	}
+	return false
+}
+
+// hasMatingMaterial проверяет, достаточно ли у стороны color материала,
+// чтобы теоретически поставить мат (используется при просрочке времени)
+func (b *Board) hasMatingMaterial(color Color) bool {
+	minors := 0
+	for row := 0; row < 8; row++ {
+		for col := 0; col < 8; col++ {
+			piece := b.Cells[row][col]
+			if piece.Color != color {
+				continue
+			}
+			switch piece.Type {
+			case Pawn, Rook, Queen:
+				return true
+			case Knight, Bishop:
+				minors++
+			}
+		}
+	}
+	return minors >= 2
+}
@@ -0,0 +1,287 @@
+package game
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// StartFEN - начальная позиция в нотации FEN
+const StartFEN = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+
+// ParseFEN создает доску из строки в нотации Forsyth-Edwards
+func ParseFEN(fen string) (*Board, error) {
+	fields := strings.Fields(fen)
+	if len(fields) < 4 || len(fields) > 6 {
+		return nil, fmt.Errorf("некорректный FEN %q: ожидается от 4 до 6 полей", fen)
+	}
+
+	b := &Board{ClaimDraws: true}
+
+	// Расстановка фигур
+	ranks := strings.Split(fields[0], "/")
+	if len(ranks) != 8 {
+		return nil, fmt.Errorf("некорректный FEN %q: ожидается 8 горизонталей", fen)
+	}
+	for row, rank := range ranks {
+		col := 0
+		for _, ch := range rank {
+			if ch >= '1' && ch <= '8' {
+				for n := 0; n < int(ch-'0'); n++ {
+					if col > 7 {
+						return nil, fmt.Errorf("некорректный FEN %q: слишком длинная горизонталь %d", fen, 8-row)
+					}
+					b.Cells[row][col] = Piece{Empty, White}
+					col++
+				}
+				continue
+			}
+			piece, ok := pieceFromChar(ch)
+			if !ok {
+				return nil, fmt.Errorf("некорректный FEN %q: неизвестная фигура %q", fen, ch)
+			}
+			if col > 7 {
+				return nil, fmt.Errorf("некорректный FEN %q: слишком длинная горизонталь %d", fen, 8-row)
+			}
+			b.Cells[row][col] = piece
+			col++
+		}
+		if col != 8 {
+			return nil, fmt.Errorf("некорректный FEN %q: горизонталь %d содержит %d клеток", fen, 8-row, col)
+		}
+	}
+
+	// У каждой стороны ровно один король, а пешек на крайних горизонталях не бывает
+	kings := map[Color]int{}
+	for row := 0; row < 8; row++ {
+		for col := 0; col < 8; col++ {
+			piece := b.Cells[row][col]
+			switch {
+			case piece.Type == King:
+				kings[piece.Color]++
+			case piece.Type == Pawn && (row == 0 || row == 7):
+				return nil, fmt.Errorf("некорректный FEN %q: пешка на горизонтали %d", fen, 8-row)
+			}
+		}
+	}
+	if kings[White] != 1 || kings[Black] != 1 {
+		return nil, fmt.Errorf("некорректный FEN %q: у каждой стороны должен быть ровно один король", fen)
+	}
+
+	whiteKing := b.findKing(White)
+	blackKing := b.findKing(Black)
+
+	// Очередь хода
+	switch fields[1] {
+	case "w":
+		b.CurrentTurn = White
+	case "b":
+		b.CurrentTurn = Black
+	default:
+		return nil, fmt.Errorf("некорректный FEN %q: неизвестная очередь хода %q", fen, fields[1])
+	}
+
+	// Права на рокировку
+	castling := fields[2]
+	if castling != "-" {
+		for _, ch := range castling {
+			if !strings.ContainsRune("KQkq", ch) {
+				return nil, fmt.Errorf("некорректный FEN %q: неизвестный флаг рокировки %q", fen, ch)
+			}
+		}
+	}
+	b.WhiteRookHMoved = !strings.ContainsRune(castling, 'K')
+	b.WhiteRookAMoved = !strings.ContainsRune(castling, 'Q')
+	b.BlackRookHMoved = !strings.ContainsRune(castling, 'k')
+	b.BlackRookAMoved = !strings.ContainsRune(castling, 'q')
+	b.WhiteKingMoved = (b.WhiteRookHMoved && b.WhiteRookAMoved) || whiteKing != (Position{Row: 7, Col: 4})
+	b.BlackKingMoved = (b.BlackRookHMoved && b.BlackRookAMoved) || blackKing != (Position{Row: 0, Col: 4})
+
+	// Поле для взятия на проходе: за пешкой, только что сделавшей ход через поле, -
+	// на 6-й горизонтали, если ходят белые, и на 3-й, если черные
+	if fields[3] != "-" {
+		epRow := 5
+		if b.CurrentTurn == White {
+			epRow = 2
+		}
+		pos, err := ParseSquare(fields[3])
+		if err != nil || pos.Row != epRow {
+			return nil, fmt.Errorf("некорректный FEN %q: неверное поле взятия на проходе %q", fen, fields[3])
+		}
+		b.EnPassantTarget = &pos
+	}
+
+	// Счетчики ходов
+	fullMove := 1
+	if len(fields) > 4 {
+		halfMove, err := strconv.Atoi(fields[4])
+		if err != nil || halfMove < 0 {
+			return nil, fmt.Errorf("некорректный FEN %q: неверный счетчик полуходов %q", fen, fields[4])
+		}
+		b.HalfMoveClock = halfMove
+	}
+	if len(fields) > 5 {
+		n, err := strconv.Atoi(fields[5])
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("некорректный FEN %q: неверный номер хода %q", fen, fields[5])
+		}
+		fullMove = n
+	}
+	b.MovesCount = (fullMove - 1) * 2
+	if b.CurrentTurn == Black {
+		b.MovesCount++
+	}
+
+	// Сторона, которая не ходит, не может находиться под шахом
+	if b.isInCheck(opponent(b.CurrentTurn)) {
+		return nil, fmt.Errorf("некорректный FEN %q: король стороны, не имеющей хода, под шахом", fen)
+	}
+
+	b.hash = b.ComputeHash()
+	b.positionHistory = []uint64{b.hash}
+	b.IsCheck = b.isInCheck(b.CurrentTurn)
+	b.checkGameOver()
+
+	return b, nil
+}
+
+// FEN возвращает позицию в нотации Forsyth-Edwards
+func (b *Board) FEN() string {
+	var sb strings.Builder
+
+	// Расстановка фигур
+	for row := 0; row < 8; row++ {
+		empty := 0
+		for col := 0; col < 8; col++ {
+			piece := b.Cells[row][col]
+			if piece.Type == Empty {
+				empty++
+				continue
+			}
+			if empty > 0 {
+				sb.WriteByte(byte('0' + empty))
+				empty = 0
+			}
+			sb.WriteString(pieceToString(piece))
+		}
+		if empty > 0 {
+			sb.WriteByte(byte('0' + empty))
+		}
+		if row < 7 {
+			sb.WriteByte('/')
+		}
+	}
+
+	// Очередь хода
+	if b.CurrentTurn == White {
+		sb.WriteString(" w ")
+	} else {
+		sb.WriteString(" b ")
+	}
+
+	// Права на рокировку
+	castling := b.castlingRights()
+	if castling == "" {
+		castling = "-"
+	}
+	sb.WriteString(castling)
+
+	// Поле для взятия на проходе
+	sb.WriteByte(' ')
+	if b.EnPassantTarget != nil {
+		sb.WriteString(b.EnPassantTarget.String())
+	} else {
+		sb.WriteByte('-')
+	}
+
+	// Счетчики ходов
+	fmt.Fprintf(&sb, " %d %d", b.HalfMoveClock, b.MovesCount/2+1)
+
+	return sb.String()
+}
+
+// Права на рокировку в виде битовой маски
+const (
+	castleWhiteKingSide = 1 << iota
+	castleWhiteQueenSide
+	castleBlackKingSide
+	castleBlackQueenSide
+)
+
+// castlingMask возвращает права на рокировку в виде битовой маски
+func (b *Board) castlingMask() int {
+	mask := 0
+	whiteKing := b.Cells[7][4] == (Piece{King, White})
+	blackKing := b.Cells[0][4] == (Piece{King, Black})
+
+	if whiteKing && !b.WhiteKingMoved {
+		if !b.WhiteRookHMoved && b.Cells[7][7] == (Piece{Rook, White}) {
+			mask |= castleWhiteKingSide
+		}
+		if !b.WhiteRookAMoved && b.Cells[7][0] == (Piece{Rook, White}) {
+			mask |= castleWhiteQueenSide
+		}
+	}
+	if blackKing && !b.BlackKingMoved {
+		if !b.BlackRookHMoved && b.Cells[0][7] == (Piece{Rook, Black}) {
+			mask |= castleBlackKingSide
+		}
+		if !b.BlackRookAMoved && b.Cells[0][0] == (Piece{Rook, Black}) {
+			mask |= castleBlackQueenSide
+		}
+	}
+
+	return mask
+}
+
+// CanCastle сообщает, сохранилось ли у стороны color право на рокировку в сторону
+// короля (kingSide) или ферзя. Право не означает, что рокировка возможна прямо сейчас.
+func (b *Board) CanCastle(color Color, kingSide bool) bool {
+	flag := castleWhiteQueenSide
+	switch {
+	case color == White && kingSide:
+		flag = castleWhiteKingSide
+	case color == Black && kingSide:
+		flag = castleBlackKingSide
+	case color == Black:
+		flag = castleBlackQueenSide
+	}
+	return b.castlingMask()&flag != 0
+}
+
+// castlingRights возвращает права на рокировку в формате FEN (без "-")
+func (b *Board) castlingRights() string {
+	rights := ""
+	mask := b.castlingMask()
+	for i, letter := range "KQkq" {
+		if mask&(1<<uint(i)) != 0 {
+			rights += string(letter)
+		}
+	}
+	return rights
+}
+
+// pieceFromChar преобразует символ FEN в фигуру
+func pieceFromChar(ch rune) (Piece, bool) {
+	color := White
+	if ch >= 'a' && ch <= 'z' {
+		color = Black
+		ch -= 'a' - 'A'
+	}
+
+	switch ch {
+	case 'P':
+		return Piece{Pawn, color}, true
+	case 'N':
+		return Piece{Knight, color}, true
+	case 'B':
+		return Piece{Bishop, color}, true
+	case 'R':
+		return Piece{Rook, color}, true
+	case 'Q':
+		return Piece{Queen, color}, true
+	case 'K':
+		return Piece{King, color}, true
+	}
+	return Piece{}, false
+}
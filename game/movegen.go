@@ -0,0 +1,199 @@
+package game
+
+// bitPosition - представление позиции в виде битбордов для быстрой генерации ходов.
+// Строится из Board.Cells, поэтому публичное представление доски не меняется.
+type bitPosition struct {
+	pieces   [2][King + 1]bitboard // Фигуры по цвету и типу (индекс Empty не используется)
+	occupied [2]bitboard           // Все фигуры каждого цвета
+	all      bitboard              // Все занятые клетки
+	turn     Color
+	epSquare int // Клетка для взятия на проходе (-1, если нет)
+
+	castleKingSide  [2]bool
+	castleQueenSide [2]bool
+}
+
+// bitPosition строит битбордовое представление текущей позиции
+func (b *Board) bitPosition() bitPosition {
+	p := bitPosition{turn: b.CurrentTurn, epSquare: -1}
+
+	for row := 0; row < 8; row++ {
+		for col := 0; col < 8; col++ {
+			piece := b.Cells[row][col]
+			if piece.Type == Empty {
+				continue
+			}
+			bb := squareBB(squareIndex(Position{Row: row, Col: col}))
+			p.pieces[piece.Color][piece.Type] |= bb
+			p.occupied[piece.Color] |= bb
+		}
+	}
+	p.all = p.occupied[White] | p.occupied[Black]
+
+	if b.EnPassantTarget != nil {
+		p.epSquare = squareIndex(*b.EnPassantTarget)
+	}
+
+	// Права на рокировку: король и ладья не двигались и стоят на исходных клетках
+	whiteKing := !b.WhiteKingMoved && b.Cells[7][4] == (Piece{King, White})
+	blackKing := !b.BlackKingMoved && b.Cells[0][4] == (Piece{King, Black})
+	p.castleKingSide[White] = whiteKing && !b.WhiteRookHMoved && b.Cells[7][7] == (Piece{Rook, White})
+	p.castleQueenSide[White] = whiteKing && !b.WhiteRookAMoved && b.Cells[7][0] == (Piece{Rook, White})
+	p.castleKingSide[Black] = blackKing && !b.BlackRookHMoved && b.Cells[0][7] == (Piece{Rook, Black})
+	p.castleQueenSide[Black] = blackKing && !b.BlackRookAMoved && b.Cells[0][0] == (Piece{Rook, Black})
+
+	return p
+}
+
+// kingSquare возвращает клетку короля указанного цвета (-1, если короля нет)
+func (p *bitPosition) kingSquare(color Color) int {
+	king := p.pieces[color][King]
+	if king == 0 {
+		return -1
+	}
+	return king.lsb()
+}
+
+// isAttacked проверяет, атакована ли клетка sq фигурами цвета by при занятости occ.
+// Фигуры противника на клетках captured считаются взятыми и не атакуют.
+func (p *bitPosition) isAttacked(sq int, by Color, occ, captured bitboard) bool {
+	them := &p.pieces[by]
+	if pawnAttacks[opponent(by)][sq]&them[Pawn]&^captured != 0 {
+		return true
+	}
+	if knightAttacks[sq]&them[Knight]&^captured != 0 {
+		return true
+	}
+	if kingAttacks[sq]&them[King] != 0 {
+		return true
+	}
+	if bishopAttacks(sq, occ)&(them[Bishop]|them[Queen])&^captured != 0 {
+		return true
+	}
+	return rookAttacks(sq, occ)&(them[Rook]|them[Queen])&^captured != 0
+}
+
+// inCheck проверяет, находится ли король указанного цвета под шахом
+func (p *bitPosition) inCheck(color Color) bool {
+	king := p.kingSquare(color)
+	if king == -1 {
+		return false
+	}
+	return p.isAttacked(king, opponent(color), p.all, 0)
+}
+
+// isLegal проверяет, что псевдолегальный ход не оставляет своего короля под шахом.
+// epVictim - клетка пешки, взятой на проходе (0, если ход не является таким взятием).
+func (p *bitPosition) isLegal(from, to int, pieceType PieceType, epVictim bitboard) bool {
+	king := p.kingSquare(p.turn)
+	if pieceType == King {
+		king = to
+	}
+	if king == -1 {
+		return true
+	}
+
+	captured := squareBB(to) | epVictim
+	occ := (p.all&^squareBB(from)&^epVictim | squareBB(to))
+	return !p.isAttacked(king, opponent(p.turn), occ, captured)
+}
+
+// legalMoves генерирует псевдолегальные ходы и оставляет из них легальные
+func (p *bitPosition) legalMoves(moves []Move) []Move {
+	us, them := p.turn, opponent(p.turn)
+	own := p.occupied[us]
+	enemy := p.occupied[them]
+
+	// Пешки: ходы вперед, взятия, взятие на проходе и превращения
+	var epBB, epVictim bitboard
+	if p.epSquare >= 0 {
+		epBB = squareBB(p.epSquare)
+		if us == White {
+			epVictim = squareBB(p.epSquare - 8)
+		} else {
+			epVictim = squareBB(p.epSquare + 8)
+		}
+	}
+	for pawns := p.pieces[us][Pawn]; pawns != 0; pawns &= pawns - 1 {
+		from := pawns.lsb()
+		targets := p.pawnPushes(from) | pawnAttacks[us][from]&(enemy|epBB)
+
+		for ; targets != 0; targets &= targets - 1 {
+			to := targets.lsb()
+			var victim bitboard
+			if squareBB(to) == epBB {
+				victim = epVictim
+			}
+			if !p.isLegal(from, to, Pawn, victim) {
+				continue
+			}
+
+			move := Move{From: squarePosition(from), To: squarePosition(to)}
+			if squareBB(to)&(rank1|rank8) != 0 {
+				for _, promotion := range PromotionPieces {
+					move.Promotion = promotion
+					moves = append(moves, move)
+				}
+				continue
+			}
+			moves = append(moves, move)
+		}
+	}
+
+	// Фигуры
+	for pieceType := Knight; pieceType <= King; pieceType++ {
+		for pieces := p.pieces[us][pieceType]; pieces != 0; pieces &= pieces - 1 {
+			from := pieces.lsb()
+			targets := pieceAttacks(pieceType, from, p.all) &^ own
+			for ; targets != 0; targets &= targets - 1 {
+				to := targets.lsb()
+				if p.isLegal(from, to, pieceType, 0) {
+					moves = append(moves, Move{From: squarePosition(from), To: squarePosition(to)})
+				}
+			}
+		}
+	}
+
+	return p.castlingMoves(moves)
+}
+
+// pawnPushes возвращает клетки, на которые пешка с клетки from может пойти вперед
+func (p *bitPosition) pawnPushes(from int) bitboard {
+	pawn := squareBB(from)
+	if p.turn == White {
+		single := pawn << 8 &^ p.all
+		return single | (single&rank3)<<8&^p.all
+	}
+	single := pawn >> 8 &^ p.all
+	return single | (single&rank6)>>8&^p.all
+}
+
+// castlingMoves добавляет возможные рокировки: путь между королем и ладьей свободен,
+// король не под шахом и не проходит через атакованные клетки
+func (p *bitPosition) castlingMoves(moves []Move) []Move {
+	us, them := p.turn, opponent(p.turn)
+	if !p.castleKingSide[us] && !p.castleQueenSide[us] {
+		return moves
+	}
+
+	king := p.kingSquare(us)
+	if p.isAttacked(king, them, p.all, 0) {
+		return moves
+	}
+
+	if p.castleKingSide[us] &&
+		p.all&(squareBB(king+1)|squareBB(king+2)) == 0 &&
+		!p.isAttacked(king+1, them, p.all, 0) &&
+		!p.isAttacked(king+2, them, p.all, 0) {
+		moves = append(moves, Move{From: squarePosition(king), To: squarePosition(king + 2)})
+	}
+
+	if p.castleQueenSide[us] &&
+		p.all&(squareBB(king-1)|squareBB(king-2)|squareBB(king-3)) == 0 &&
+		!p.isAttacked(king-1, them, p.all, 0) &&
+		!p.isAttacked(king-2, them, p.all, 0) {
+		moves = append(moves, Move{From: squarePosition(king), To: squarePosition(king - 2)})
+	}
+
+	return moves
+}
@@ -0,0 +1,293 @@
+package game
+
+import (
+	"fmt"
+	"strings"
+)
+
+// pieceLetters - буквы фигур в стандартной алгебраической нотации
+var pieceLetters = map[PieceType]byte{
+	Knight: 'N',
+	Bishop: 'B',
+	Rook:   'R',
+	Queen:  'Q',
+	King:   'K',
+}
+
+// String возвращает название клетки в алгебраической нотации (например, "e4")
+func (p Position) String() string {
+	if p.Row < 0 || p.Row > 7 || p.Col < 0 || p.Col > 7 {
+		return "-"
+	}
+	return string([]byte{byte('a' + p.Col), byte('8' - p.Row)})
+}
+
+// ParseSquare разбирает название клетки в алгебраической нотации
+func ParseSquare(s string) (Position, error) {
+	if len(s) != 2 || s[0] < 'a' || s[0] > 'h' || s[1] < '1' || s[1] > '8' {
+		return Position{Row: -1, Col: -1}, fmt.Errorf("некорректная клетка %q", s)
+	}
+	return Position{Row: int('8' - s[1]), Col: int(s[0] - 'a')}, nil
+}
+
+// UCI возвращает ход в длинной алгебраической нотации UCI (например, "e2e4", "e7e8q")
+func (m Move) UCI() string {
+	uci := m.From.String() + m.To.String()
+	if m.Promotion != Empty {
+		uci += strings.ToLower(string(pieceLetters[m.Promotion]))
+	}
+	return uci
+}
+
+// String возвращает ход в нотации UCI
+func (m Move) String() string {
+	return m.UCI()
+}
+
+// ParseUCI разбирает ход в нотации UCI без проверки легальности
+func ParseUCI(s string) (Move, error) {
+	if len(s) != 4 && len(s) != 5 {
+		return Move{}, fmt.Errorf("некорректный ход UCI %q", s)
+	}
+	from, err := ParseSquare(s[0:2])
+	if err != nil {
+		return Move{}, fmt.Errorf("некорректный ход UCI %q", s)
+	}
+	to, err := ParseSquare(s[2:4])
+	if err != nil {
+		return Move{}, fmt.Errorf("некорректный ход UCI %q", s)
+	}
+	move := Move{From: from, To: to}
+	if len(s) == 5 {
+		promotion, ok := promotionFromLetter(s[4])
+		if !ok {
+			return Move{}, fmt.Errorf("некорректное превращение в ходе UCI %q", s)
+		}
+		move.Promotion = promotion
+	}
+	return move, nil
+}
+
+// promotionFromLetter возвращает фигуру превращения по букве (в любом регистре)
+func promotionFromLetter(letter byte) (PieceType, bool) {
+	switch letter {
+	case 'q', 'Q':
+		return Queen, true
+	case 'r', 'R':
+		return Rook, true
+	case 'b', 'B':
+		return Bishop, true
+	case 'n', 'N':
+		return Knight, true
+	}
+	return Empty, false
+}
+
+// SAN возвращает ход в стандартной алгебраической нотации (например, "Nf3", "exd5", "O-O", "Qh4#").
+// Ход должен быть легальным в текущей позиции. Чтобы узнать, дает ли ход шах или мат,
+// он делается и отменяется на самой доске, поэтому читать доску из других горутин
+// во время вызова нельзя.
+func (b *Board) SAN(move Move) string {
+	piece := b.Cells[move.From.Row][move.From.Col]
+	var sb strings.Builder
+
+	if piece.Type == King && abs(move.To.Col-move.From.Col) == 2 {
+		if move.To.Col > move.From.Col {
+			sb.WriteString("O-O")
+		} else {
+			sb.WriteString("O-O-O")
+		}
+	} else {
+		isCapture := b.Cells[move.To.Row][move.To.Col].Type != Empty
+		if piece.Type == Pawn {
+			if move.From.Col != move.To.Col {
+				// Взятие пешкой (в том числе на проходе)
+				sb.WriteByte(byte('a' + move.From.Col))
+				isCapture = true
+			}
+		} else {
+			sb.WriteByte(pieceLetters[piece.Type])
+			sb.WriteString(b.disambiguation(move, piece))
+		}
+		if isCapture {
+			sb.WriteByte('x')
+		}
+		sb.WriteString(move.To.String())
+		if isPromotionMove(move, piece) {
+			promotion := move.Promotion
+			if promotion == Empty {
+				promotion = Queen
+			}
+			sb.WriteByte('=')
+			sb.WriteByte(pieceLetters[promotion])
+		}
+	}
+
+	// Шах или мат
+	b.MakeMove(move)
+	if b.IsCheck {
+		// Партия может закончиться ходом с шахом и без мата - ничьей по правилу 50 ходов или повторению
+		if b.Termination == Checkmate {
+			sb.WriteByte('#')
+		} else {
+			sb.WriteByte('+')
+		}
+	}
+	b.UnmakeMove()
+
+	return sb.String()
+}
+
+// disambiguation возвращает уточнение исходной клетки, если на поле назначения
+// может пойти несколько одноименных фигур
+func (b *Board) disambiguation(move Move, piece Piece) string {
+	sameFile, sameRank, ambiguous := false, false, false
+	for _, other := range b.GetLegalMoves() {
+		if other.To != move.To || other.From == move.From {
+			continue
+		}
+		if b.Cells[other.From.Row][other.From.Col] != piece {
+			continue
+		}
+		ambiguous = true
+		if other.From.Col == move.From.Col {
+			sameFile = true
+		}
+		if other.From.Row == move.From.Row {
+			sameRank = true
+		}
+	}
+
+	switch {
+	case !ambiguous:
+		return ""
+	case !sameFile:
+		return string(rune('a' + move.From.Col))
+	case !sameRank:
+		return string(rune('8' - move.From.Row))
+	default:
+		return move.From.String()
+	}
+}
+
+// ParseSAN находит легальный ход, соответствующий записи в стандартной алгебраической нотации
+func (b *Board) ParseSAN(san string) (Move, error) {
+	s := strings.TrimRight(san, "+#!?")
+	legal := b.GetLegalMoves()
+
+	// Рокировка
+	if s == "O-O" || s == "0-0" || s == "O-O-O" || s == "0-0-0" {
+		kingSide := len(s) == 3
+		for _, m := range legal {
+			piece := b.Cells[m.From.Row][m.From.Col]
+			if piece.Type == King && abs(m.To.Col-m.From.Col) == 2 && (m.To.Col > m.From.Col) == kingSide {
+				return m, nil
+			}
+		}
+		return Move{}, fmt.Errorf("нелегальная рокировка %q", san)
+	}
+
+	// Фигура
+	pieceType := Pawn
+	if len(s) > 0 {
+		for pt, letter := range pieceLetters {
+			if s[0] == letter {
+				pieceType = pt
+				s = s[1:]
+				break
+			}
+		}
+	}
+
+	// Превращение: "e8=N" или "e8N"; без указания фигуры - в ферзя
+	promotion := Empty
+	if i := strings.IndexByte(s, '='); i >= 0 {
+		if len(s) != i+2 {
+			return Move{}, fmt.Errorf("некорректное превращение в ходе %q", san)
+		}
+		pt, ok := promotionFromLetter(s[i+1])
+		if !ok || s[i+1] < 'A' || s[i+1] > 'Z' {
+			return Move{}, fmt.Errorf("некорректное превращение в ходе %q", san)
+		}
+		promotion = pt
+		s = s[:i]
+	} else if pieceType == Pawn && len(s) > 2 && s[len(s)-1] >= 'A' && s[len(s)-1] <= 'Z' {
+		pt, ok := promotionFromLetter(s[len(s)-1])
+		if !ok {
+			return Move{}, fmt.Errorf("некорректное превращение в ходе %q", san)
+		}
+		promotion = pt
+		s = s[:len(s)-1]
+	}
+
+	s = strings.Replace(s, "x", "", 1)
+	if len(s) < 2 {
+		return Move{}, fmt.Errorf("некорректный ход %q", san)
+	}
+	to, err := ParseSquare(s[len(s)-2:])
+	if err != nil {
+		return Move{}, fmt.Errorf("некорректное поле в ходе %q", san)
+	}
+
+	// Уточнение исходной клетки: вертикаль и/или горизонталь
+	fromCol, fromRow := -1, -1
+	for _, ch := range s[:len(s)-2] {
+		switch {
+		case ch >= 'a' && ch <= 'h':
+			fromCol = int(ch - 'a')
+		case ch >= '1' && ch <= '8':
+			fromRow = int('8' - ch)
+		default:
+			return Move{}, fmt.Errorf("некорректный ход %q", san)
+		}
+	}
+
+	var found []Move
+	for _, m := range legal {
+		if m.To != to || b.Cells[m.From.Row][m.From.Col].Type != pieceType {
+			continue
+		}
+		if (fromCol != -1 && m.From.Col != fromCol) || (fromRow != -1 && m.From.Row != fromRow) {
+			continue
+		}
+		if m.Promotion != Empty {
+			want := promotion
+			if want == Empty {
+				want = Queen
+			}
+			if m.Promotion != want {
+				continue
+			}
+		} else if promotion != Empty {
+			continue
+		}
+		found = append(found, m)
+	}
+
+	switch len(found) {
+	case 0:
+		return Move{}, fmt.Errorf("нелегальный ход %q", san)
+	case 1:
+		return found[0], nil
+	default:
+		return Move{}, fmt.Errorf("неоднозначный ход %q", san)
+	}
+}
+
+// ParseMove разбирает ход в нотации UCI ("e2e4", "e7e8n"), координатной записи
+// ("e2 e4", "e7 e8 n") или SAN ("Nf3", "e8=N") и проверяет его легальность
+func (b *Board) ParseMove(s string) (Move, error) {
+	s = strings.TrimSpace(s)
+	if parts := strings.Fields(s); len(parts) == 2 || len(parts) == 3 {
+		s = strings.Join(parts, "")
+	}
+
+	if move, err := ParseUCI(s); err == nil {
+		if !b.IsValidMove(move) {
+			return Move{}, fmt.Errorf("нелегальный ход %q", s)
+		}
+		return move, nil
+	}
+
+	return b.ParseSAN(s)
+}
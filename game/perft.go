@@ -0,0 +1,110 @@
+package game
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Perft считает количество листовых узлов дерева легальных ходов глубины depth.
+// Используется для проверки корректности генератора ходов и отмены ходов.
+func (b *Board) Perft(depth int) uint64 {
+	if depth <= 0 {
+		return 1
+	}
+
+	moves := b.GetLegalMoves()
+	if depth == 1 {
+		return uint64(len(moves))
+	}
+
+	var nodes uint64
+	for _, move := range moves {
+		b.applyMove(move)
+		nodes += b.Perft(depth - 1)
+		b.UnmakeMove()
+	}
+	return nodes
+}
+
+// DivideEntry - количество узлов perft после одного хода из корня
+type DivideEntry struct {
+	Move  Move
+	Nodes uint64
+}
+
+// Divide возвращает результат perft(depth-1) для каждого легального хода,
+// отсортированный по записи хода в UCI. Сумма узлов равна Perft(depth).
+func (b *Board) Divide(depth int) []DivideEntry {
+	if depth <= 0 {
+		return nil
+	}
+
+	var entries []DivideEntry
+	for _, move := range b.GetLegalMoves() {
+		b.applyMove(move)
+		entries = append(entries, DivideEntry{Move: move, Nodes: b.Perft(depth - 1)})
+		b.UnmakeMove()
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Move.UCI() < entries[j].Move.UCI()
+	})
+	return entries
+}
+
+// CompareMoveGen обходит дерево ходов глубины depth и в каждой позиции сравнивает
+// генератор ходов на битбордах с эталонным перебором через IsValidMove, а также
+// проверяет инкрементальный ключ Zobrist и то, что UnmakeMove восстанавливает позицию.
+// Возвращает ошибку с FEN первой позиции, в которой обнаружено расхождение.
+func (b *Board) CompareMoveGen(depth int) error {
+	if depth <= 0 {
+		return nil
+	}
+
+	if hash := b.ComputeHash(); b.hash != hash {
+		return fmt.Errorf("позиция %s: ключ Zobrist %016x, ожидался %016x", b.FEN(), b.hash, hash)
+	}
+
+	moves := b.GetLegalMoves()
+	missing, extra := diffMoves(b.legalMovesScan(), moves)
+	if len(missing) > 0 || len(extra) > 0 {
+		return fmt.Errorf("позиция %s: не сгенерированы ходы [%s], лишние ходы [%s]",
+			b.FEN(), strings.Join(missing, " "), strings.Join(extra, " "))
+	}
+
+	fen := b.FEN()
+	for _, move := range moves {
+		b.applyMove(move)
+		err := b.CompareMoveGen(depth - 1)
+		b.UnmakeMove()
+		if err != nil {
+			return err
+		}
+		// Отмена хода должна в точности восстановить позицию
+		if restored := b.FEN(); restored != fen {
+			return fmt.Errorf("позиция %s: после отмены хода %s получена позиция %s", fen, move.UCI(), restored)
+		}
+	}
+	return nil
+}
+
+// diffMoves возвращает ходы из expected, отсутствующие в actual, и лишние ходы из actual
+func diffMoves(expected, actual []Move) (missing, extra []string) {
+	seen := make(map[Move]bool, len(actual))
+	for _, move := range actual {
+		seen[move] = true
+	}
+	for _, move := range expected {
+		if !seen[move] {
+			missing = append(missing, move.UCI())
+		}
+		delete(seen, move)
+	}
+	for _, move := range actual {
+		if seen[move] {
+			extra = append(extra, move.UCI())
+		}
+	}
+	return missing, extra
+}
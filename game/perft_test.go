@@ -0,0 +1,104 @@
+package game
+
+import (
+	"fmt"
+	"testing"
+)
+
+// perftCase - позиция с известным количеством узлов perft
+type perftCase struct {
+	name  string
+	fen   string
+	depth int
+	nodes uint64
+}
+
+// perftCases - эталонные позиции для проверки генератора ходов: начальная позиция,
+// Kiwipete, позиции 3-6 из Chess Programming Wiki и позиции с крайними случаями
+// взятия на проходе, рокировки и превращения
+var perftCases = []perftCase{
+	{"initial", StartFEN, 1, 20},
+	{"initial", StartFEN, 2, 400},
+	{"initial", StartFEN, 3, 8902},
+	{"initial", StartFEN, 4, 197281},
+	{"initial", StartFEN, 5, 4865609},
+	{"kiwipete", "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", 1, 48},
+	{"kiwipete", "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", 2, 2039},
+	{"kiwipete", "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", 3, 97862},
+	{"kiwipete", "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", 4, 4085603},
+	{"position 3", "8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1", 1, 14},
+	{"position 3", "8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1", 2, 191},
+	{"position 3", "8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1", 3, 2812},
+	{"position 3", "8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1", 4, 43238},
+	{"position 3", "8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1", 5, 674624},
+	{"position 4", "r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1", 1, 6},
+	{"position 4", "r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1", 2, 264},
+	{"position 4", "r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1", 3, 9467},
+	{"position 4", "r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1", 4, 422333},
+	{"position 5", "rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8", 1, 44},
+	{"position 5", "rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8", 2, 1486},
+	{"position 5", "rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8", 3, 62379},
+	{"position 5", "rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8", 4, 2103487},
+	{"position 6", "r4rk1/1pp1qppp/p1np1n2/2b1p1B1/2B1P1b1/P1NP1N2/1PP1QPPP/R4RK1 w - - 0 10", 1, 46},
+	{"position 6", "r4rk1/1pp1qppp/p1np1n2/2b1p1B1/2B1P1b1/P1NP1N2/1PP1QPPP/R4RK1 w - - 0 10", 2, 2079},
+	{"position 6", "r4rk1/1pp1qppp/p1np1n2/2b1p1B1/2B1P1b1/P1NP1N2/1PP1QPPP/R4RK1 w - - 0 10", 3, 89890},
+	{"position 6", "r4rk1/1pp1qppp/p1np1n2/2b1p1B1/2B1P1b1/P1NP1N2/1PP1QPPP/R4RK1 w - - 0 10", 4, 3894594},
+	{"illegal en passant (pin on rank)", "3k4/3p4/8/K1P4r/8/8/8/8 b - - 0 1", 6, 1134888},
+	{"illegal en passant (pin on diagonal)", "8/8/4k3/8/2p5/8/B2P2K1/8 w - - 0 1", 6, 1015133},
+	{"en passant gives check", "8/8/1k6/2b5/2pP4/8/5K2/8 b - d3 0 1", 6, 1440467},
+	{"short castling gives check", "5k2/8/8/8/8/8/8/4K2R w K - 0 1", 6, 661072},
+	{"long castling gives check", "3k4/8/8/8/8/8/8/R3K3 w Q - 0 1", 6, 803711},
+	{"castling rights", "r3k2r/1b4bq/8/8/8/8/7B/R3K2R w KQkq - 0 1", 4, 1274206},
+	{"castling prevented", "r3k2r/8/3Q4/8/8/5q2/8/R3K2R b KQkq - 0 1", 4, 1720476},
+	{"promotion out of check", "2K2r2/4P3/8/8/8/8/8/3k4 w - - 0 1", 6, 3821001},
+	{"discovered check", "8/8/1P2K3/8/2n5/1q6/8/5k2 b - - 0 1", 5, 1004658},
+	{"promotion gives check", "4k3/1P6/8/8/8/8/K7/8 w - - 0 1", 6, 217342},
+	{"under-promotion gives check", "8/P1k5/K7/8/8/8/8/8 w - - 0 1", 6, 92683},
+	{"self stalemate", "K1k5/8/P7/8/8/8/8/8 w - - 0 1", 6, 2217},
+	{"stalemate and checkmate", "8/k1P5/8/1K6/8/8/8/8 w - - 0 1", 7, 567584},
+	{"stalemate and checkmate 2", "8/8/2k5/5q2/5n2/8/5K2/8 b - - 0 1", 4, 23527},
+}
+
+// shortPerftNodes - в режиме -short пропускаются позиции с большим числом узлов
+const shortPerftNodes = 100000
+
+func TestPerft(t *testing.T) {
+	for _, c := range perftCases {
+		c := c
+		t.Run(fmt.Sprintf("%s/depth%d", c.name, c.depth), func(t *testing.T) {
+			if testing.Short() && c.nodes > shortPerftNodes {
+				t.Skipf("глубина %d: %d узлов", c.depth, c.nodes)
+			}
+			board, err := ParseFEN(c.fen)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if nodes := board.Perft(c.depth); nodes != c.nodes {
+				t.Errorf("perft(%d) = %d, ожидалось %d", c.depth, nodes, c.nodes)
+			}
+		})
+	}
+}
+
+// TestCompareMoveGen сверяет генератор ходов на битбордах с эталонным перебором,
+// ключи Zobrist и отмену ходов в деревьях эталонных позиций
+func TestCompareMoveGen(t *testing.T) {
+	depth := 3
+	if testing.Short() {
+		depth = 2
+	}
+	seen := make(map[string]bool)
+	for _, c := range perftCases {
+		if seen[c.fen] {
+			continue
+		}
+		seen[c.fen] = true
+		board, err := ParseFEN(c.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := board.CompareMoveGen(depth); err != nil {
+			t.Errorf("%s: %v", c.name, err)
+		}
+	}
+}
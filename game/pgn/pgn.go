@@ -0,0 +1,488 @@
+// Package pgn читает и записывает партии в формате Portable Game Notation
+package pgn
+
+import (
+	"bufio"
+	"chess-ai/game"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Результаты партии в нотации PGN
+const (
+	ResultWhiteWins = "1-0"
+	ResultBlackWins = "0-1"
+	ResultDraw      = "1/2-1/2"
+	ResultUnknown   = "*"
+)
+
+// sevenTagRoster - обязательные теги PGN в стандартном порядке
+var sevenTagRoster = []string{"Event", "Site", "Date", "Round", "White", "Black", "Result"}
+
+// Game представляет одну партию PGN
+type Game struct {
+	Tags  map[string]string
+	Moves []game.Move
+}
+
+// NewGame создает партию с заполненными обязательными тегами
+func NewGame(white, black string) *Game {
+	return &Game{
+		Tags: map[string]string{
+			"Event":  "Chess AI game",
+			"Site":   "?",
+			"Date":   time.Now().Format("2006.01.02"),
+			"Round":  "-",
+			"White":  white,
+			"Black":  black,
+			"Result": ResultUnknown,
+		},
+	}
+}
+
+// SetStartPosition задает нестандартную начальную позицию партии
+func (g *Game) SetStartPosition(board *game.Board) {
+	fen := board.FEN()
+	if fen == game.StartFEN {
+		delete(g.Tags, "SetUp")
+		delete(g.Tags, "FEN")
+		return
+	}
+	g.Tags["SetUp"] = "1"
+	g.Tags["FEN"] = fen
+}
+
+// SetEpsilon записывает параметры исследования агентов в теги партии
+func (g *Game) SetEpsilon(white, black float64) {
+	g.Tags["WhiteEpsilon"] = strconv.FormatFloat(white, 'f', 4, 64)
+	g.Tags["BlackEpsilon"] = strconv.FormatFloat(black, 'f', 4, 64)
+}
+
+// SetResult записывает результат и причину окончания партии по итоговой позиции
+func (g *Game) SetResult(board *game.Board) {
+	g.Tags["Result"] = board.Result.String()
+	if !board.GameOver {
+		delete(g.Tags, "Termination")
+		return
+	}
+
+	// Значения тега Termination по стандарту PGN
+	switch board.Termination {
+	case game.Timeout:
+		g.Tags["Termination"] = "time forfeit"
+	case game.Adjudication:
+		g.Tags["Termination"] = "adjudication"
+	default:
+		g.Tags["Termination"] = "normal"
+	}
+}
+
+// StartBoard возвращает начальную позицию партии
+func (g *Game) StartBoard() (*game.Board, error) {
+	if fen, ok := g.Tags["FEN"]; ok {
+		return game.ParseFEN(fen)
+	}
+	return game.NewBoard(), nil
+}
+
+// Board воспроизводит ходы партии и возвращает итоговую позицию
+func (g *Game) Board() (*game.Board, error) {
+	board, err := g.StartBoard()
+	if err != nil {
+		return nil, err
+	}
+	for i, move := range g.Moves {
+		if !board.IsValidMove(move) {
+			return nil, fmt.Errorf("нелегальный ход %d в партии", i+1)
+		}
+		board.MakeMove(move)
+	}
+	return board, nil
+}
+
+// String возвращает партию в формате PGN
+func (g *Game) String() string {
+	var sb strings.Builder
+	g.write(&sb)
+	return sb.String()
+}
+
+// Write записывает партии в формате PGN
+func Write(w io.Writer, games ...*Game) error {
+	bw := bufio.NewWriter(w)
+	for _, g := range games {
+		if err := g.write(bw); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// AppendToFile дописывает партию в конец PGN файла, создавая его при необходимости
+func AppendToFile(path string, g *Game) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("не удалось создать директорию: %v", err)
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return Write(file, g)
+}
+
+// write записывает теги и ходы одной партии
+func (g *Game) write(w io.Writer) error {
+	result := g.Tags["Result"]
+	if result == "" {
+		result = ResultUnknown
+	}
+
+	// Сначала обязательные теги в стандартном порядке, затем остальные по алфавиту
+	var extra []string
+	for name := range g.Tags {
+		if !isSevenTagRoster(name) {
+			extra = append(extra, name)
+		}
+	}
+	sort.Strings(extra)
+
+	var sb strings.Builder
+	for _, name := range append(append([]string{}, sevenTagRoster...), extra...) {
+		value, ok := g.Tags[name]
+		if !ok {
+			value = "?"
+		}
+		if name == "Result" {
+			value = result
+		}
+		fmt.Fprintf(&sb, "[%s \"%s\"]\n", name, escapeTag(value))
+	}
+	sb.WriteByte('\n')
+
+	movetext, err := g.movetext()
+	if err != nil {
+		return err
+	}
+	tokens := append(movetext, result)
+
+	// Строки movetext не длиннее 80 символов
+	lineLen := 0
+	for _, token := range tokens {
+		if lineLen > 0 && lineLen+1+len(token) > 80 {
+			sb.WriteByte('\n')
+			lineLen = 0
+		}
+		if lineLen > 0 {
+			sb.WriteByte(' ')
+			lineLen++
+		}
+		sb.WriteString(token)
+		lineLen += len(token)
+	}
+	sb.WriteString("\n\n")
+
+	_, err = io.WriteString(w, sb.String())
+	return err
+}
+
+// movetext возвращает ходы партии в SAN вместе с номерами ходов
+func (g *Game) movetext() ([]string, error) {
+	board, err := g.StartBoard()
+	if err != nil {
+		return nil, err
+	}
+
+	var tokens []string
+	for i, move := range g.Moves {
+		if !board.IsValidMove(move) {
+			return nil, fmt.Errorf("нелегальный ход %d в партии", i+1)
+		}
+		moveNumber := board.MovesCount/2 + 1
+		if board.CurrentTurn == game.White {
+			tokens = append(tokens, fmt.Sprintf("%d.", moveNumber))
+		} else if i == 0 {
+			tokens = append(tokens, fmt.Sprintf("%d...", moveNumber))
+		}
+		tokens = append(tokens, board.SAN(move))
+		board.MakeMove(move)
+	}
+	return tokens, nil
+}
+
+// Parse читает все партии из PGN
+func Parse(r io.Reader) ([]*Game, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{input: string(data), line: 1}
+	var games []*Game
+	for {
+		g, err := p.parseGame()
+		if err != nil {
+			return games, err
+		}
+		if g == nil {
+			return games, nil
+		}
+		games = append(games, g)
+	}
+}
+
+// ParseFile читает все партии из PGN файла
+func ParseFile(path string) ([]*Game, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return Parse(file)
+}
+
+// parser разбирает текст PGN
+type parser struct {
+	input string
+	pos   int
+	line  int
+}
+
+// parseGame разбирает одну партию; возвращает nil в конце ввода
+func (p *parser) parseGame() (*Game, error) {
+	g := &Game{Tags: map[string]string{}}
+
+	// Секция тегов
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.input) || p.input[p.pos] != '[' {
+			break
+		}
+		name, value, err := p.parseTag()
+		if err != nil {
+			return nil, err
+		}
+		g.Tags[name] = value
+	}
+
+	p.skipSpace()
+	if p.pos >= len(p.input) {
+		if len(g.Tags) == 0 {
+			return nil, nil
+		}
+		return nil, p.errorf("партия без ходов и результата")
+	}
+
+	board, err := g.StartBoard()
+	if err != nil {
+		return nil, p.errorf("%v", err)
+	}
+
+	// Секция ходов
+	for {
+		token, err := p.nextToken()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case token == "":
+			// Конец ввода без завершающего результата
+			if _, ok := g.Tags["Result"]; !ok {
+				g.Tags["Result"] = ResultUnknown
+			}
+			return g, nil
+		case isResult(token):
+			g.Tags["Result"] = token
+			return g, nil
+		case isMoveNumber(token):
+			continue
+		}
+
+		move, err := board.ParseSAN(token)
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		board.MakeMove(move)
+		g.Moves = append(g.Moves, move)
+	}
+}
+
+// parseTag разбирает тег вида [Name "Value"]
+func (p *parser) parseTag() (string, string, error) {
+	p.pos++ // '['
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.input) && !isSpace(p.input[p.pos]) && p.input[p.pos] != '"' {
+		p.pos++
+	}
+	name := p.input[start:p.pos]
+	p.skipSpace()
+	if name == "" || p.pos >= len(p.input) || p.input[p.pos] != '"' {
+		return "", "", p.errorf("некорректный тег")
+	}
+	p.pos++
+
+	var value strings.Builder
+	for {
+		if p.pos >= len(p.input) || p.input[p.pos] == '\n' {
+			return "", "", p.errorf("незакрытое значение тега %s", name)
+		}
+		ch := p.input[p.pos]
+		p.pos++
+		if ch == '"' {
+			break
+		}
+		if ch == '\\' && p.pos < len(p.input) {
+			ch = p.input[p.pos]
+			p.pos++
+		}
+		value.WriteByte(ch)
+	}
+
+	p.skipSpace()
+	if p.pos >= len(p.input) || p.input[p.pos] != ']' {
+		return "", "", p.errorf("незакрытый тег %s", name)
+	}
+	p.pos++
+	return name, value.String(), nil
+}
+
+// nextToken возвращает следующий значимый токен секции ходов,
+// пропуская комментарии, варианты и NAG. Пустая строка - конец ввода.
+func (p *parser) nextToken() (string, error) {
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.input) {
+			return "", nil
+		}
+
+		switch ch := p.input[p.pos]; {
+		case ch == '{':
+			end := strings.IndexByte(p.input[p.pos:], '}')
+			if end < 0 {
+				return "", p.errorf("незакрытый комментарий")
+			}
+			p.advance(end + 1)
+		case ch == ';' || (ch == '%' && p.atLineStart()):
+			end := strings.IndexByte(p.input[p.pos:], '\n')
+			if end < 0 {
+				end = len(p.input) - p.pos
+			}
+			p.advance(end)
+		case ch == '(':
+			if err := p.skipVariation(); err != nil {
+				return "", err
+			}
+		case ch == '$':
+			p.pos++
+			for p.pos < len(p.input) && p.input[p.pos] >= '0' && p.input[p.pos] <= '9' {
+				p.pos++
+			}
+		case ch == '[':
+			return "", p.errorf("тег внутри секции ходов")
+		default:
+			start := p.pos
+			for p.pos < len(p.input) && !isSpace(p.input[p.pos]) && !strings.ContainsRune("{;()$[", rune(p.input[p.pos])) {
+				p.pos++
+				// Номер хода может быть записан слитно с ходом: "1.e4"
+				if p.input[p.pos-1] == '.' && (p.pos >= len(p.input) || p.input[p.pos] != '.') {
+					break
+				}
+			}
+			return p.input[start:p.pos], nil
+		}
+	}
+}
+
+// skipVariation пропускает вариант в скобках (с учетом вложенности)
+func (p *parser) skipVariation() error {
+	depth := 0
+	for p.pos < len(p.input) {
+		switch p.input[p.pos] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				p.pos++
+				return nil
+			}
+		case '{':
+			end := strings.IndexByte(p.input[p.pos:], '}')
+			if end < 0 {
+				return p.errorf("незакрытый комментарий")
+			}
+			p.advance(end)
+		case '\n':
+			p.line++
+		}
+		p.pos++
+	}
+	return p.errorf("незакрытый вариант")
+}
+
+// skipSpace пропускает пробельные символы
+func (p *parser) skipSpace() {
+	for p.pos < len(p.input) && isSpace(p.input[p.pos]) {
+		if p.input[p.pos] == '\n' {
+			p.line++
+		}
+		p.pos++
+	}
+}
+
+// advance сдвигает позицию, учитывая переводы строк
+func (p *parser) advance(n int) {
+	p.line += strings.Count(p.input[p.pos:p.pos+n], "\n")
+	p.pos += n
+}
+
+// atLineStart сообщает, находится ли позиция в начале строки
+func (p *parser) atLineStart() bool {
+	return p.pos == 0 || p.input[p.pos-1] == '\n'
+}
+
+// errorf возвращает ошибку с номером строки
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("pgn: строка %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+func isSevenTagRoster(name string) bool {
+	for _, tag := range sevenTagRoster {
+		if tag == name {
+			return true
+		}
+	}
+	return false
+}
+
+func isResult(token string) bool {
+	return token == ResultWhiteWins || token == ResultBlackWins || token == ResultDraw || token == ResultUnknown
+}
+
+// isMoveNumber проверяет токены вида "12." и "12..."
+func isMoveNumber(token string) bool {
+	digits := strings.TrimRight(token, ".")
+	if digits == "" || digits == token {
+		return false
+	}
+	_, err := strconv.Atoi(digits)
+	return err == nil
+}
+
+func isSpace(ch byte) bool {
+	return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r'
+}
+
+func escapeTag(value string) string {
+	value = strings.ReplaceAll(value, "\\", "\\\\")
+	return strings.ReplaceAll(value, "\"", "\\\"")
+}
@@ -0,0 +1,255 @@
+// Package polyglot читает дебютные книги в формате Polyglot (.bin) и выбирает из них ходы.
+//
+// Книга - отсортированный по ключу позиции массив 16-байтовых записей (big-endian):
+// ключ позиции (8 байт), ход (2 байта), вес (2 байта) и поле learn (4 байта).
+// Ключ позиции Polyglot вычисляется по своим случайным числам и не совпадает
+// с ключом Zobrist доски.
+package polyglot
+
+import (
+	"bufio"
+	"chess-ai/game"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+)
+
+// entrySize - размер записи книги в байтах
+const entrySize = 16
+
+// Смещения в random64
+const (
+	castleOffset    = 768
+	enPassantOffset = 772
+	turnOffset      = 780
+)
+
+// Selection - способ выбора хода из книги
+type Selection int
+
+const (
+	// WeightedRandom выбирает ход случайно с вероятностью, пропорциональной его весу
+	WeightedRandom Selection = iota
+	// BestMove выбирает ход с наибольшим весом
+	BestMove
+)
+
+// ParseSelection разбирает способ выбора хода: "weighted" или "best"
+func ParseSelection(s string) (Selection, error) {
+	switch s {
+	case "weighted":
+		return WeightedRandom, nil
+	case "best":
+		return BestMove, nil
+	}
+	return 0, fmt.Errorf("неизвестный способ выбора хода из книги %q (ожидается weighted или best)", s)
+}
+
+// Entry - ход из книги для позиции
+type Entry struct {
+	Move   game.Move
+	Weight uint16 // Вес хода (обычно зависит от числа и результатов партий с ним)
+	Learn  uint32
+}
+
+// entry - запись файла книги
+type entry struct {
+	key    uint64
+	move   uint16
+	weight uint16
+	learn  uint32
+}
+
+// Book - дебютная книга, целиком загруженная в память. Книгу можно использовать
+// из нескольких горутин одновременно, если не менять ее поля.
+type Book struct {
+	Selection Selection // Способ выбора хода
+	MaxPly    int       // Книга используется только в первых MaxPly полуходах партии (0 - без ограничения)
+
+	entries []entry
+}
+
+// Open загружает книгу из файла
+func Open(path string) (*Book, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	book, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения книги %s: %v", path, err)
+	}
+	return book, nil
+}
+
+// Read читает книгу из r
+func Read(r io.Reader) (*Book, error) {
+	book := &Book{}
+	reader := bufio.NewReader(r)
+	var buf [entrySize]byte
+	for {
+		if _, err := io.ReadFull(reader, buf[:]); err != nil {
+			if err == io.EOF {
+				break
+			}
+			if err == io.ErrUnexpectedEOF {
+				return nil, fmt.Errorf("размер файла не кратен %d байтам", entrySize)
+			}
+			return nil, err
+		}
+		book.entries = append(book.entries, entry{
+			key:    binary.BigEndian.Uint64(buf[0:8]),
+			move:   binary.BigEndian.Uint16(buf[8:10]),
+			weight: binary.BigEndian.Uint16(buf[10:12]),
+			learn:  binary.BigEndian.Uint32(buf[12:16]),
+		})
+	}
+
+	// Книги Polyglot отсортированы по ключу, но поиск не должен зависеть от этого
+	if !sort.SliceIsSorted(book.entries, func(i, j int) bool { return book.entries[i].key < book.entries[j].key }) {
+		sort.SliceStable(book.entries, func(i, j int) bool { return book.entries[i].key < book.entries[j].key })
+	}
+	return book, nil
+}
+
+// Len возвращает количество записей в книге
+func (b *Book) Len() int {
+	return len(b.entries)
+}
+
+// Key вычисляет ключ позиции Polyglot
+func Key(board *game.Board) uint64 {
+	var key uint64
+	for row := 0; row < 8; row++ {
+		for col := 0; col < 8; col++ {
+			piece := board.Cells[row][col]
+			if piece.Type == game.Empty {
+				continue
+			}
+			// Виды фигур: черная пешка, белая пешка, черный конь, белый конь и так далее
+			kind := 2 * int(piece.Type-game.Pawn)
+			if piece.Color == game.White {
+				kind++
+			}
+			rank := 7 - row
+			key ^= random64[64*kind+8*rank+col]
+		}
+	}
+
+	for i, right := range []struct {
+		color    game.Color
+		kingSide bool
+	}{{game.White, true}, {game.White, false}, {game.Black, true}, {game.Black, false}} {
+		if board.CanCastle(right.color, right.kingSide) {
+			key ^= random64[castleOffset+i]
+		}
+	}
+
+	// Вертикаль взятия на проходе учитывается, только если рядом с пешкой,
+	// сделавшей двойной ход, стоит пешка стороны, которая делает ход
+	if ep := board.EnPassantTarget; ep != nil {
+		row := ep.Row + 1
+		if board.CurrentTurn == game.Black {
+			row = ep.Row - 1
+		}
+		for _, col := range []int{ep.Col - 1, ep.Col + 1} {
+			if row >= 0 && row <= 7 && col >= 0 && col <= 7 && board.Cells[row][col] == (game.Piece{Type: game.Pawn, Color: board.CurrentTurn}) {
+				key ^= random64[enPassantOffset+ep.Col]
+				break
+			}
+		}
+	}
+
+	if board.CurrentTurn == game.White {
+		key ^= random64[turnOffset]
+	}
+	return key
+}
+
+// Entries возвращает легальные ходы книги для позиции board в порядке записей книги
+func (b *Book) Entries(board *game.Board) []Entry {
+	key := Key(board)
+	i := sort.Search(len(b.entries), func(i int) bool { return b.entries[i].key >= key })
+
+	var result []Entry
+	legal := board.GetLegalMoves()
+	for ; i < len(b.entries) && b.entries[i].key == key; i++ {
+		e := b.entries[i]
+		if move, ok := decodeMove(board, e.move, legal); ok {
+			result = append(result, Entry{Move: move, Weight: e.weight, Learn: e.learn})
+		}
+	}
+	return result
+}
+
+// Move выбирает ход из книги для позиции board. Возвращает false, если позиции
+// нет в книге, у всех ее ходов нулевой вес или партия длиннее MaxPly полуходов.
+func (b *Book) Move(board *game.Board) (game.Move, bool) {
+	if b.MaxPly > 0 && board.MovesCount >= b.MaxPly {
+		return game.Move{}, false
+	}
+
+	entries := b.Entries(board)
+	total := 0
+	best := -1
+	for i, e := range entries {
+		total += int(e.Weight)
+		if e.Weight > 0 && (best < 0 || e.Weight > entries[best].Weight) {
+			best = i
+		}
+	}
+	if total == 0 {
+		return game.Move{}, false
+	}
+
+	if b.Selection == BestMove {
+		return entries[best].Move, true
+	}
+
+	r := rand.Intn(total)
+	for _, e := range entries {
+		if r < int(e.Weight) {
+			return e.Move, true
+		}
+		r -= int(e.Weight)
+	}
+	return entries[best].Move, true
+}
+
+// decodeMove находит среди легальных ходов ход, записанный в книге. Биты хода:
+// 0-5 - клетка "куда", 6-11 - клетка "откуда" (вертикаль в младших трех битах, затем
+// горизонталь), 12-14 - фигура превращения (1 - конь, 2 - слон, 3 - ладья, 4 - ферзь).
+// Рокировка записывается как ход короля на клетку своей ладьи.
+func decodeMove(board *game.Board, m uint16, legal []game.Move) (game.Move, bool) {
+	square := func(sq uint16) game.Position {
+		return game.Position{Row: 7 - int(sq>>3&7), Col: int(sq & 7)}
+	}
+	from, to := square(m>>6&63), square(m&63)
+
+	promotion := game.Empty
+	if p := m >> 12 & 7; p >= 1 && p <= 4 {
+		promotion = game.Knight + game.PieceType(p-1)
+	}
+
+	piece := board.Cells[from.Row][from.Col]
+	if piece.Type == game.King && from.Col == 4 && to.Row == from.Row {
+		switch to.Col {
+		case 7:
+			to.Col = 6
+		case 0:
+			to.Col = 2
+		}
+	}
+
+	for _, move := range legal {
+		if move.From == from && move.To == to && move.Promotion == promotion {
+			return move, true
+		}
+	}
+	return game.Move{}, false
+}
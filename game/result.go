@@ -0,0 +1,141 @@
+package game
+
+// Result - результат партии
+type Result int
+
+const (
+	Ongoing Result = iota
+	WhiteWins
+	BlackWins
+	Draw
+)
+
+// String возвращает результат в нотации PGN ("1-0", "0-1", "1/2-1/2", "*")
+func (r Result) String() string {
+	switch r {
+	case WhiteWins:
+		return "1-0"
+	case BlackWins:
+		return "0-1"
+	case Draw:
+		return "1/2-1/2"
+	default:
+		return "*"
+	}
+}
+
+// WinnerName возвращает победителя в виде строки ("white", "black", "draw"),
+// которая используется в базе данных и статистике. Для незавершенной партии - "".
+func (r Result) WinnerName() string {
+	switch r {
+	case WhiteWins:
+		return "white"
+	case BlackWins:
+		return "black"
+	case Draw:
+		return "draw"
+	default:
+		return ""
+	}
+}
+
+// ScoreFor возвращает очки игрока указанного цвета: 1 - победа, 0.5 - ничья, 0 - поражение
+func (r Result) ScoreFor(color Color) float64 {
+	switch r {
+	case WhiteWins:
+		if color == White {
+			return 1.0
+		}
+		return 0.0
+	case BlackWins:
+		if color == Black {
+			return 1.0
+		}
+		return 0.0
+	default:
+		return 0.5
+	}
+}
+
+// WinFor возвращает результат "победа стороны color"
+func WinFor(color Color) Result {
+	if color == White {
+		return WhiteWins
+	}
+	return BlackWins
+}
+
+// Termination - причина окончания партии
+type Termination int
+
+const (
+	NotTerminated Termination = iota
+	Checkmate
+	Stalemate
+	Repetition
+	FiftyMoveRule
+	InsufficientMaterial
+	Resignation
+	Timeout
+	Adjudication
+)
+
+// String возвращает название причины окончания партии
+func (t Termination) String() string {
+	switch t {
+	case Checkmate:
+		return "checkmate"
+	case Stalemate:
+		return "stalemate"
+	case Repetition:
+		return "repetition"
+	case FiftyMoveRule:
+		return "fifty-move rule"
+	case InsufficientMaterial:
+		return "insufficient material"
+	case Resignation:
+		return "resignation"
+	case Timeout:
+		return "timeout"
+	case Adjudication:
+		return "adjudication"
+	default:
+		return ""
+	}
+}
+
+// endGame завершает партию с указанным результатом
+func (b *Board) endGame(result Result, termination Termination) {
+	b.GameOver = true
+	b.Result = result
+	b.Termination = termination
+}
+
+// Resign завершает партию сдачей стороны color
+func (b *Board) Resign(color Color) {
+	if b.GameOver {
+		return
+	}
+	b.endGame(WinFor(opponent(color)), Resignation)
+}
+
+// Timeout завершает партию просрочкой времени стороной color.
+// Если у соперника недостаточно материала для мата, засчитывается ничья.
+func (b *Board) Timeout(color Color) {
+	if b.GameOver {
+		return
+	}
+	if !b.hasMatingMaterial(opponent(color)) {
+		b.endGame(Draw, Timeout)
+		return
+	}
+	b.endGame(WinFor(opponent(color)), Timeout)
+}
+
+// Adjudicate завершает партию решением арбитра (например, по лимиту ходов)
+func (b *Board) Adjudicate(result Result) {
+	if b.GameOver {
+		return
+	}
+	b.endGame(result, Adjudication)
+}
@@ -0,0 +1,69 @@
+package game
+
+// Случайные ключи Zobrist: для каждой фигуры на каждой клетке, для каждого
+// набора прав на рокировку, для вертикали взятия на проходе и для хода черных
+var (
+	zobristPieces    [2][King + 1][64]uint64
+	zobristCastling  [16]uint64
+	zobristEnPassant [8]uint64
+	zobristBlack     uint64
+)
+
+func init() {
+	rng := magicRand{state: 1070372}
+	for color := White; color <= Black; color++ {
+		for pieceType := Pawn; pieceType <= King; pieceType++ {
+			for sq := 0; sq < 64; sq++ {
+				zobristPieces[color][pieceType][sq] = rng.next()
+			}
+		}
+	}
+	for i := range zobristCastling {
+		zobristCastling[i] = rng.next()
+	}
+	for i := range zobristEnPassant {
+		zobristEnPassant[i] = rng.next()
+	}
+	zobristBlack = rng.next()
+}
+
+// Hash возвращает 64-битный ключ Zobrist текущей позиции. Ключ учитывает расстановку
+// фигур, очередь хода, права на рокировку и возможность взятия на проходе
+// и обновляется инкрементально при каждом ходе.
+func (b *Board) Hash() uint64 {
+	return b.hash
+}
+
+// ComputeHash вычисляет ключ Zobrist текущей позиции с нуля
+func (b *Board) ComputeHash() uint64 {
+	var hash uint64
+	for row := 0; row < 8; row++ {
+		for col := 0; col < 8; col++ {
+			piece := b.Cells[row][col]
+			if piece.Type != Empty {
+				hash ^= zobristPieces[piece.Color][piece.Type][squareIndex(Position{Row: row, Col: col})]
+			}
+		}
+	}
+	return hash ^ b.stateHash()
+}
+
+// stateHash возвращает часть ключа, не зависящую от расстановки фигур: очередь хода,
+// права на рокировку и вертикаль взятия на проходе (только если взятие возможно)
+func (b *Board) stateHash() uint64 {
+	hash := zobristCastling[b.castlingMask()]
+	if b.CurrentTurn == Black {
+		hash ^= zobristBlack
+	}
+	if b.canCaptureEnPassant() {
+		hash ^= zobristEnPassant[b.EnPassantTarget.Col]
+	}
+	return hash
+}
+
+// togglePiece добавляет фигуру на клетке pos в ключ позиции или убирает ее из ключа
+func (b *Board) togglePiece(piece Piece, pos Position) {
+	if piece.Type != Empty {
+		b.hash ^= zobristPieces[piece.Color][piece.Type][squareIndex(pos)]
+	}
+}
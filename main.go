@@ -5,33 +5,352 @@ import (
 	"chess-ai/agent"
 	"chess-ai/database"
 	"chess-ai/game"
+	"chess-ai/game/pgn"
+	"chess-ai/game/polyglot"
+	"chess-ai/neural"
 	"chess-ai/selfplay"
 	"chess-ai/stats"
+	"chess-ai/uci"
 	"chess-ai/ui"
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 func main() {
 	// Определяем флаги командной строки
 	terminalMode := flag.Bool("terminal", false, "Запустить в терминальном режиме")
 	selfPlayMode := flag.Bool("self-play", false, "Режим самообучения (AI играет сам с собой)")
+	uciMode := flag.Bool("uci", false, "Режим UCI движка для шахматных оболочек (stdin/stdout)")
+	trainMode := flag.Bool("train", false, "Обучение с учителем на размеченных позициях из --dataset или базы данных")
 	numGames := flag.Int("games", 100, "Количество игр для самообучения")
+	datasetPath := flag.String("dataset", "", "Файл позиций для --train: строки вида FEN;оценка (1-0, 0-1, 1/2-1/2 или число от 0 до 1 для стороны, которая делает ход). Без файла позиции берутся из партий в базе данных")
+	epochs := flag.Int("epochs", 10, "Количество эпох обучения с учителем")
+	batchSize := flag.Int("batch-size", 64, "Размер пакета при обучении с учителем")
+	validationSplit := flag.Float64("val-split", 0.1, "Доля проверочных данных при обучении с учителем: партий из базы данных или позиций из --dataset")
 	dbPath := flag.String("db", "data/chess.db", "Путь к базе данных SQLite")
+	startFEN := flag.String("fen", "", "Начальная позиция в нотации FEN (по умолчанию стандартная)")
+	pgnPath := flag.String("pgn", "", "PGN файл, в который дописываются сыгранные партии")
+	perftDepth := flag.Int("perft", 0, "Посчитать perft указанной глубины для позиции --fen (с разбивкой по ходам)")
+	perftSuite := flag.Bool("perft-suite", false, "Проверить генератор ходов на эталонных позициях perft")
+	perftMaxNodes := flag.Uint64("perft-max-nodes", 5000000, "Пропускать эталонные позиции perft с большим числом узлов")
+	perftCompare := flag.Int("perft-compare", 0, "Сверить генератор ходов с эталонным перебором до указанной глубины (вместе с --perft или --perft-suite)")
+	moveTime := flag.Int("movetime", 1000, "Время на обдумывание хода AI в миллисекундах (терминал и веб)")
+	depth := flag.Int("depth", 0, "Максимальная глубина поиска AI (0 - без ограничения)")
+	threads := flag.Int("threads", 1, "Количество потоков поиска AI")
+	skill := flag.Int("skill", agent.MaxSkillLevel, fmt.Sprintf("Уровень силы AI от %d до %d (терминал и веб)", agent.MinSkillLevel, agent.MaxSkillLevel))
+	bookPath := flag.String("book", "", "Дебютная книга в формате Polyglot (.bin) для игры и самообучения")
+	bookDepth := flag.Int("book-depth", 16, "Сколько полуходов партии играть по дебютной книге (0 - без ограничения)")
+	bookMode := flag.String("book-mode", "weighted", "Выбор хода из книги: weighted (случайно по весам) или best (с наибольшим весом)")
+	modelPath := flag.String("model", agent.DefaultModelPath, "Файл модели нейросети AI")
+	selfPlayModelPath := flag.String("selfplay-model", "models/selfplay.model", "Файл модели самообучения в веб-интерфейсе")
+	optimizer := flag.String("optimizer", "", "Оптимизатор обучения нейросети: sgd, nesterov, adam или adamw (по умолчанию - из модели)")
+	learningRate := flag.Float64("lr", 0, "Базовая скорость обучения нейросети (по умолчанию - из модели)")
+	weightDecay := flag.Float64("weight-decay", 0, "Коэффициент weight decay оптимизатора (по умолчанию - из модели)")
+	schedule := flag.String("lr-schedule", "", "Расписание скорости обучения: constant, step:период:множитель или cosine:длина[:минимум], через запятую можно добавить warmup:шагов")
+	layers := flag.String("layers", "", "Слои нейросети через запятую в виде размер:активация, например 512:relu,256:crelu,1:tanh (активации: linear, relu, crelu, leaky_relu, tanh, sigmoid)")
 	flag.Parse()
 
-	if *selfPlayMode {
-		runSelfPlay(*numGames, *dbPath)
+	limits := agent.SearchLimits{
+		Depth:    *depth,
+		MoveTime: time.Duration(*moveTime) * time.Millisecond,
+	}
+
+	if *threads < 1 {
+		fmt.Printf("Ошибка: количество потоков должно быть больше нуля (указано: %d)\n", *threads)
+		os.Exit(1)
+	}
+	if *skill < agent.MinSkillLevel || *skill > agent.MaxSkillLevel {
+		fmt.Printf("Ошибка: уровень силы должен быть от %d до %d (указано: %d)\n", agent.MinSkillLevel, agent.MaxSkillLevel, *skill)
+		os.Exit(1)
+	}
+
+	if *layers != "" {
+		parsed, err := neural.ParseLayers(*layers)
+		if err == nil {
+			err = neural.Config{InputSize: agent.InputSize, Layers: parsed}.Validate()
+		}
+		if err != nil {
+			fmt.Printf("Ошибка в архитектуре нейросети: %v\n", err)
+			os.Exit(1)
+		}
+		agent.NetworkLayers = parsed
+	}
+
+	training, err := parseTrainingOptions(*optimizer, *learningRate, *weightDecay, *schedule)
+	if err != nil {
+		fmt.Printf("Ошибка в параметрах обучения: %v\n", err)
+		os.Exit(1)
+	}
+
+	var book *polyglot.Book
+	if *bookPath != "" {
+		selection, err := polyglot.ParseSelection(*bookMode)
+		if err != nil {
+			fmt.Printf("Ошибка: %v\n", err)
+			os.Exit(1)
+		}
+		book, err = polyglot.Open(*bookPath)
+		if err != nil {
+			fmt.Printf("Ошибка при загрузке дебютной книги: %v\n", err)
+			os.Exit(1)
+		}
+		book.Selection = selection
+		book.MaxPly = *bookDepth
+	}
+
+	// Проверяем начальную позицию до запуска любого режима
+	if *startFEN != "" {
+		board, err := game.ParseFEN(*startFEN)
+		if err != nil {
+			fmt.Printf("Ошибка: %v\n", err)
+			os.Exit(1)
+		}
+		// С законченной позиции нельзя начать партию: каждая новая партия сразу бы
+		// заканчивалась. Для perft такая позиция допустима.
+		playing := !*perftSuite && *perftDepth <= 0 && !*uciMode && !*trainMode
+		if playing && board.GameOver {
+			fmt.Printf("Ошибка: партия в начальной позиции %q уже окончена (%s)\n", *startFEN, board.Termination)
+			os.Exit(1)
+		}
+	}
+
+	if *perftSuite {
+		runPerftSuite(*perftMaxNodes, *perftCompare)
+	} else if *perftDepth > 0 {
+		runPerft(*perftDepth, *startFEN, *perftCompare)
+	} else if *uciMode {
+		runUCI(*modelPath, *threads)
+	} else if *trainMode {
+		runTrain(*datasetPath, *dbPath, *modelPath, *epochs, *batchSize, *validationSplit, training)
+	} else if *selfPlayMode {
+		runSelfPlay(*numGames, *dbPath, *modelPath, *startFEN, *pgnPath, *threads, book, training)
 	} else if *terminalMode {
-		runTerminal(*dbPath)
+		runTerminal(*dbPath, *modelPath, *startFEN, *pgnPath, limits, *threads, *skill, book, training)
 	} else {
-		runWeb(*dbPath)
+		runWeb(*dbPath, *modelPath, *selfPlayModelPath, *startFEN, *pgnPath, limits, *threads, *skill, book, training)
+	}
+}
+
+// trainingOptions - параметры обучения нейросети, явно заданные в командной строке.
+// Нулевые значения означают, что параметр берется из модели.
+type trainingOptions struct {
+	optimizer    neural.OptimizerType
+	learningRate float64
+	weightDecay  *float64
+	schedule     *neural.Schedule
+}
+
+// parseTrainingOptions разбирает флаги обучения; учитываются только указанные флаги
+func parseTrainingOptions(optimizer string, learningRate, weightDecay float64, schedule string) (trainingOptions, error) {
+	var opts trainingOptions
+	var err error
+	if flagSet("optimizer") {
+		if opts.optimizer, err = neural.ParseOptimizerType(optimizer); err != nil {
+			return opts, err
+		}
+	}
+	if flagSet("lr") {
+		if learningRate <= 0 {
+			return opts, fmt.Errorf("скорость обучения должна быть больше нуля (указано: %g)", learningRate)
+		}
+		opts.learningRate = learningRate
+	}
+	if flagSet("weight-decay") {
+		if weightDecay < 0 {
+			return opts, fmt.Errorf("weight decay не может быть отрицательным (указано: %g)", weightDecay)
+		}
+		opts.weightDecay = &weightDecay
+	}
+	if flagSet("lr-schedule") {
+		s, err := neural.ParseSchedule(schedule)
+		if err != nil {
+			return opts, err
+		}
+		opts.schedule = &s
+	}
+	return opts, nil
+}
+
+// apply задает сети явно указанные параметры обучения. При смене типа оптимизатора
+// его состояние из модели сбрасывается.
+func (o trainingOptions) apply(n *neural.Network) error {
+	config := n.Optimizer.Config()
+	if o.optimizer != "" && o.optimizer != config.Type {
+		decay := config.WeightDecay
+		config = neural.DefaultOptimizerConfig(o.optimizer)
+		config.WeightDecay = decay
+	}
+	if o.weightDecay != nil {
+		config.WeightDecay = *o.weightDecay
+	}
+	if err := n.SetOptimizer(config); err != nil {
+		return err
+	}
+	if o.learningRate > 0 {
+		n.LearningRate = o.learningRate
+	}
+	if o.schedule != nil {
+		n.Schedule = *o.schedule
+	}
+	return nil
+}
+
+// loadModel загружает нейросеть агента из ai.ModelPath, задает ей параметры обучения
+// training и сообщает о модели в log. Если файла еще нет, агент начинает обучение
+// со случайных весов. Поврежденная или несовместимая модель (в том числе
+// с архитектурой, отличной от заданной флагом --layers) - ошибка.
+func loadModel(ai *agent.Agent, training trainingOptions, log io.Writer) {
+	err := ai.Load()
+	if os.IsNotExist(err) {
+		fmt.Fprintf(log, "Модель %s не найдена, нейросеть %s начинает обучение с нуля\n", ai.ModelPath, ai.Network.Config)
+		err = nil
+	} else if err == nil && flagSet("layers") && !ai.Network.Config.Equal(agent.NetworkConfig()) {
+		err = fmt.Errorf("%s: архитектура модели %s не совпадает с --layers (%s)", ai.ModelPath, ai.Network.Config, agent.NetworkConfig())
+	} else if err == nil {
+		fmt.Fprintf(log, "Загружена модель %s\n", ai.ModelPath)
+	}
+	if err == nil {
+		err = training.apply(ai.Network)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка при загрузке модели: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(log, "Нейросеть: %s\n", ai.Network.Info())
+}
+
+// flagSet проверяет, указан ли флаг в командной строке
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// newGameBoard создает доску с начальной позицией из FEN или стандартной
+func newGameBoard(fen string) *game.Board {
+	if fen == "" {
+		return game.NewBoard()
+	}
+	board, err := game.ParseFEN(fen)
+	if err != nil {
+		// FEN проверяется при запуске, поэтому сюда попадать не должны
+		return game.NewBoard()
+	}
+	return board
+}
+
+func runPerft(depth int, startFEN string, compareDepth int) {
+	board := newGameBoard(startFEN)
+	fmt.Printf("Позиция: %s\n", board.FEN())
+
+	start := time.Now()
+	var total uint64
+	for _, entry := range board.Divide(depth) {
+		fmt.Printf("%s: %d\n", entry.Move.UCI(), entry.Nodes)
+		total += entry.Nodes
+	}
+	elapsed := time.Since(start)
+
+	fmt.Printf("\nУзлов: %d\n", total)
+	fmt.Printf("Время: %s (%.0f узлов/сек)\n", elapsed.Round(time.Millisecond), float64(total)/elapsed.Seconds())
+
+	if compareDepth > 0 {
+		if err := board.CompareMoveGen(compareDepth); err != nil {
+			fmt.Printf("\nГенераторы ходов расходятся: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("\nГенераторы ходов совпадают до глубины %d\n", compareDepth)
+	}
+}
+
+// perftPositions - стандартные позиции для быстрой проверки генератора ходов из командной
+// строки: количество узлов perft по глубинам, начиная с первой. Полный набор эталонных
+// позиций с крайними случаями проверяется тестами пакета game (go test ./game).
+var perftPositions = []struct {
+	name  string
+	fen   string
+	nodes []uint64
+}{
+	{"initial", game.StartFEN, []uint64{20, 400, 8902, 197281, 4865609}},
+	{"kiwipete", "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", []uint64{48, 2039, 97862, 4085603}},
+	{"position 3", "8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1", []uint64{14, 191, 2812, 43238, 674624}},
+	{"position 4", "r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1", []uint64{6, 264, 9467, 422333}},
+	{"position 5", "rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8", []uint64{44, 1486, 62379, 2103487}},
+	{"position 6", "r4rk1/1pp1qppp/p1np1n2/2b1p1B1/2B1P1b1/P1NP1N2/1PP1QPPP/R4RK1 w - - 0 10", []uint64{46, 2079, 89890, 3894594}},
+}
+
+func runPerftSuite(maxNodes uint64, compareDepth int) {
+	fmt.Println("=== Проверка генератора ходов (perft) ===")
+
+	failed := 0
+	for _, p := range perftPositions {
+		board, err := game.ParseFEN(p.fen)
+		if err != nil {
+			fmt.Printf("ОШИБКА   %-12s %v\n", p.name, err)
+			failed++
+			continue
+		}
+
+		for i, expected := range p.nodes {
+			depth := i + 1
+			if expected > maxNodes {
+				fmt.Printf("ПРОПУСК  %-12s глубина %d (%d узлов)\n", p.name, depth, expected)
+				continue
+			}
+
+			start := time.Now()
+			nodes := board.Perft(depth)
+			elapsed := time.Since(start).Round(time.Millisecond)
+			if nodes != expected {
+				failed++
+				fmt.Printf("ОШИБКА   %-12s глубина %d: получено %d узлов, ожидалось %d\n", p.name, depth, nodes, expected)
+				continue
+			}
+			fmt.Printf("OK       %-12s глубина %d: %d узлов за %s\n", p.name, depth, nodes, elapsed)
+		}
+
+		// Сверяем генератор на битбордах с эталонным перебором
+		if compareDepth > 0 {
+			if err := board.CompareMoveGen(compareDepth); err != nil {
+				failed++
+				fmt.Printf("ОШИБКА   %-12s сверка генераторов: %v\n", p.name, err)
+			}
+		}
+	}
+
+	if failed > 0 {
+		fmt.Printf("\nНе пройдено проверок: %d\n", failed)
+		os.Exit(1)
 	}
+	fmt.Println("\nВсе позиции пройдены")
 }
 
-func runSelfPlay(numGames int, dbPath string) {
+// runUCI запускает движок по протоколу UCI. В stdout нельзя писать ничего,
+// кроме ответов протокола, поэтому режим работает без приветствия и базы данных.
+func runUCI(modelPath string, threads int) {
+	ai := agent.NewAgent(game.White)
+	ai.Threads = threads
+	ai.ModelPath = modelPath
+	loadModel(ai, trainingOptions{}, os.Stderr)
+
+	engine := uci.NewEngine(ai, os.Stdout)
+	if err := engine.Run(os.Stdin); err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка чтения команд UCI: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func runSelfPlay(numGames int, dbPath string, modelPath string, startFEN string, pgnPath string, threads int, book *polyglot.Book, training trainingOptions) {
 	fmt.Println("=== Режим самообучения шахматной нейросети ===")
 
 	// Валидация параметров
@@ -50,6 +369,20 @@ func runSelfPlay(numGames int, dbPath string) {
 
 	// Создаем менеджер самообучения
 	manager := selfplay.NewSelfPlayManager(db)
+	manager.StartFEN = startFEN
+	manager.PGNPath = pgnPath
+	manager.SetThreads(threads)
+	manager.SetBook(book)
+	manager.SetModelPath(modelPath)
+	if err := manager.Load(); err != nil && !os.IsNotExist(err) {
+		fmt.Printf("Ошибка при загрузке модели: %v\n", err)
+		os.Exit(1)
+	}
+	if err := training.apply(manager.Network()); err != nil {
+		fmt.Printf("Ошибка в параметрах обучения: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Нейросеть: %s\n", manager.Network().Info())
 
 	// Запускаем обучение
 	err = manager.Train(numGames, true)
@@ -61,13 +394,107 @@ func runSelfPlay(numGames int, dbPath string) {
 	fmt.Println("\nОбучение успешно завершено!")
 }
 
-func runWeb(dbPath string) {
+// runTrain обучает нейросеть с учителем на позициях из файла datasetPath или,
+// если файл не указан, из партий в базе данных. Лучшая по ошибке на проверочных
+// позициях сеть сохраняется в modelPath.
+func runTrain(datasetPath string, dbPath string, modelPath string, epochs int, batchSize int, validationSplit float64, training trainingOptions) {
+	fmt.Println("=== Обучение нейросети с учителем ===")
+
+	if epochs <= 0 || batchSize <= 0 {
+		fmt.Printf("Ошибка: количество эпох и размер пакета должны быть больше нуля (указано: %d и %d)\n", epochs, batchSize)
+		os.Exit(1)
+	}
+	if validationSplit < 0 || validationSplit >= 1 {
+		fmt.Printf("Ошибка: доля проверочных позиций должна быть от 0 до 1 (указано: %g)\n", validationSplit)
+		os.Exit(1)
+	}
+
+	var train, validation *neural.Dataset
+	if datasetPath != "" {
+		data, err := agent.LoadDataset(datasetPath)
+		if err != nil {
+			fmt.Printf("Ошибка при чтении позиций: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Загружено позиций из %s: %d\n", datasetPath, data.Len())
+
+		// Позиции в файле не связаны с партиями, поэтому делятся по отдельности
+		data.Shuffle(nil)
+		train, validation = data.Split(validationSplit)
+	} else {
+		db, err := database.NewDatabase(dbPath)
+		if err != nil {
+			fmt.Printf("Ошибка при подключении к базе данных: %v\n", err)
+			os.Exit(1)
+		}
+		games, err := db.GetFinishedGames()
+		db.Close()
+		if err != nil {
+			fmt.Printf("Ошибка при чтении партий из базы данных: %v\n", err)
+			os.Exit(1)
+		}
+		var skipped agent.SkippedGames
+		train, validation, skipped = agent.DatasetFromGames(games, validationSplit)
+		fmt.Printf("Загружено позиций из %d партий базы данных %s: %d\n", len(games)-skipped.Total(), dbPath, train.Len()+validation.Len())
+		if skipped.Total() > 0 {
+			fmt.Printf("Пропущено партий: %d (начаты не из начальной позиции: %d, с нелегальным ходом: %d)\n",
+				skipped.Total(), skipped.OtherStart, skipped.IllegalMoves)
+		}
+	}
+	if train.Len() == 0 {
+		fmt.Println("Ошибка: нет позиций для обучения")
+		os.Exit(1)
+	}
+
+	ai := agent.NewAgent(game.White)
+	ai.ModelPath = modelPath
+	loadModel(ai, training, os.Stdout)
+	network := ai.Network
+
+	fmt.Printf("Обучающих позиций: %d, проверочных: %d\n", train.Len(), validation.Len())
+	if validation.Len() > 0 {
+		fmt.Printf("До обучения: ошибка проверки %.4f, точность %.1f%%\n",
+			network.Loss(validation.Inputs, validation.Targets), network.Evaluate(validation.Inputs, validation.Targets)*100)
+	}
+	fmt.Println()
+
+	start := time.Now()
+	best, err := network.Fit(train, validation, neural.FitOptions{
+		Epochs:     epochs,
+		BatchSize:  batchSize,
+		Shuffle:    true,
+		Checkpoint: modelPath,
+		OnEpoch: func(stats neural.EpochStats) {
+			mark := ""
+			if stats.Best {
+				mark = " - лучшая, сохранена"
+			}
+			fmt.Printf("Эпоха %d/%d: ошибка обучения %.4f, проверки %.4f, точность %.1f%%%s\n",
+				stats.Epoch, epochs, stats.TrainLoss, stats.ValidationLoss, stats.Accuracy*100, mark)
+		},
+	})
+	if err != nil {
+		fmt.Printf("Ошибка при сохранении модели: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("\nОбучение завершено за %s. Лучшая эпоха %d (ошибка проверки %.4f, точность %.1f%%) сохранена в %s\n",
+		time.Since(start).Round(time.Second), best.Epoch, best.ValidationLoss, best.Accuracy*100, modelPath)
+}
+
+func runWeb(dbPath string, modelPath string, selfPlayModelPath string, startFEN string, pgnPath string, limits agent.SearchLimits, threads int, skill int, book *polyglot.Book, training trainingOptions) {
 	fmt.Println("=== Шахматы с обучающейся нейросетью ===")
 	fmt.Println("Запуск веб-сервера...")
 	fmt.Println("Откройте браузер на http://localhost:8080")
 
-	board := game.NewBoard()
+	board := newGameBoard(startFEN)
 	ai := agent.NewAgent(game.Black)
+	ai.Limits = limits
+	ai.Threads = threads
+	ai.SetSkillLevel(skill)
+	ai.Book = book
+	ai.ModelPath = modelPath
+	loadModel(ai, training, os.Stdout)
 	statistics := stats.NewStatistics()
 
 	// Подключаем базу данных
@@ -81,18 +508,37 @@ func runWeb(dbPath string) {
 	}
 
 	webUI := ui.NewWebUI(board, ai, statistics)
+	webUI.SetStartFEN(startFEN)
+	webUI.SetPGNPath(pgnPath)
+	if err := webUI.SetSelfPlayModelPath(selfPlayModelPath); err != nil {
+		fmt.Printf("Ошибка при загрузке модели самообучения: %v\n", err)
+		os.Exit(1)
+	}
+	if err := training.apply(webUI.SelfPlayNetwork()); err != nil {
+		fmt.Printf("Ошибка в параметрах обучения: %v\n", err)
+		os.Exit(1)
+	}
 	webUI.Start(8080)
 }
 
-func runTerminal(dbPath string) {
+func runTerminal(dbPath string, modelPath string, startFEN string, pgnPath string, limits agent.SearchLimits, threads int, skill int, book *polyglot.Book, training trainingOptions) {
 	fmt.Println("=== Шахматы с обучающейся нейросетью ===")
 	fmt.Println("Вы играете белыми (заглавные буквы)")
-	fmt.Println("Введите ход в формате: e2 e4")
-	fmt.Println("Для рокировки: e1 g1 (короткая) или e1 c1 (длинная)")
+	fmt.Println("Введите ход в формате: e2 e4, e2e4 или Nf3")
+	fmt.Println("Для рокировки: e1 g1 или O-O (короткая), e1 c1 или O-O-O (длинная)")
+	fmt.Println("Для превращения пешки: e7 e8 n, e7e8n или e8=N (по умолчанию ферзь)")
+	fmt.Println("Чтобы взять ход назад, введите undo")
+	fmt.Printf("Уровень силы AI: skill <%d-%d> (сейчас %d)\n", agent.MinSkillLevel, agent.MaxSkillLevel, skill)
 	fmt.Println()
 
-	board := game.NewBoard()
+	board := newGameBoard(startFEN)
 	ai := agent.NewAgent(game.Black)
+	ai.Limits = limits
+	ai.Threads = threads
+	ai.SetSkillLevel(skill)
+	ai.Book = book
+	ai.ModelPath = modelPath
+	loadModel(ai, training, os.Stdout)
 
 	// Подключаем базу данных
 	db, err := database.NewDatabase(dbPath)
@@ -107,15 +553,24 @@ func runTerminal(dbPath string) {
 
 	scanner := bufio.NewScanner(os.Stdin)
 	gamesPlayed := 0
+	record := newTerminalRecord(board)
 
 	for {
 		fmt.Print(board.String())
 
 		if board.GameOver {
 			handleGameOver(board, ai, &gamesPlayed)
-			board = game.NewBoard()
+			if pgnPath != "" {
+				record.SetResult(board)
+				if err := pgn.AppendToFile(pgnPath, record); err != nil {
+					fmt.Printf("Не удалось сохранить партию в PGN: %v\n", err)
+				}
+			}
+			board = newGameBoard(startFEN)
+			record = newTerminalRecord(board)
 			ai.StateHistory = nil
 			ai.RewardHistory = nil
+			ai.NewGame()
 			continue
 		}
 
@@ -127,29 +582,101 @@ func runTerminal(dbPath string) {
 
 			input := scanner.Text()
 			if input == "quit" || input == "exit" {
-				ai.Save()
+				if err := ai.Save(); err != nil {
+					fmt.Printf("Не удалось сохранить модель: %v\n", err)
+				}
 				fmt.Println("Игра сохранена. До свидания!")
 				break
 			}
+			if input == "resign" {
+				board.Resign(game.White)
+				continue
+			}
+			if input == "fen" {
+				fmt.Println(board.FEN())
+				continue
+			}
+			if input == "pgn" {
+				fmt.Print(record.String())
+				continue
+			}
+			if input == "undo" {
+				if undone := takeBack(board, ai, record); undone > 0 {
+					fmt.Printf("Отменено полуходов: %d\n", undone)
+				} else {
+					fmt.Println("Нет ходов для отмены")
+				}
+				continue
+			}
+			if strings.HasPrefix(input, "skill") {
+				setSkill(ai, strings.TrimSpace(strings.TrimPrefix(input, "skill")))
+				continue
+			}
 
-			move := parseMove(input)
-			if !board.IsValidMove(move) {
-				fmt.Println("Некорректный ход! Попробуйте еще раз.")
+			move, err := board.ParseMove(input)
+			if err != nil {
+				fmt.Printf("Некорректный ход (%v)! Попробуйте еще раз.\n", err)
 				continue
 			}
 
 			board.MakeMove(move)
+			record.Moves = append(record.Moves, move)
 
 		} else {
 			fmt.Println("AI думает...")
 			ai.RecordState(board)
-			move := ai.ChooseMove(board)
+			result := ai.ChooseMoveContext(context.Background(), board)
+			move := result.BestMove
+			san := board.SAN(move)
+			if result.Depth > 0 {
+				fmt.Printf("Оценка %+.3f, глубина %d, вариант: %s\n", result.Score, result.Depth, result.SAN(board))
+			}
 			board.MakeMove(move)
-			fmt.Printf("AI ходит: %s -> %s\n",
-				posToString(move.From),
-				posToString(move.To))
+			record.Moves = append(record.Moves, move)
+			fmt.Printf("AI ходит: %s (%s)\n", san, move.UCI())
+		}
+	}
+}
+
+// setSkill меняет уровень силы AI командой терминала "skill <уровень>"
+func setSkill(ai *agent.Agent, value string) {
+	if value == "" {
+		fmt.Printf("Уровень силы AI: %d\n", ai.SkillLevel())
+		return
+	}
+	level, err := strconv.Atoi(value)
+	if err != nil || level < agent.MinSkillLevel || level > agent.MaxSkillLevel {
+		fmt.Printf("Уровень силы должен быть числом от %d до %d\n", agent.MinSkillLevel, agent.MaxSkillLevel)
+		return
+	}
+	ai.SetSkillLevel(level)
+	fmt.Printf("Уровень силы AI: %d\n", level)
+}
+
+// takeBack отменяет последний ход игрока вместе с ответом AI, чтобы снова был ход игрока.
+// Возвращает количество отмененных полуходов.
+func takeBack(board *game.Board, ai *agent.Agent, record *pgn.Game) int {
+	undone := 0
+	for board.CanUnmakeMove() && (undone == 0 || board.CurrentTurn == ai.Color) {
+		board.UnmakeMove()
+		if len(record.Moves) > 0 {
+			record.Moves = record.Moves[:len(record.Moves)-1]
+		}
+		undone++
+
+		// Состояние, записанное AI перед отмененным ходом, больше не относится к партии
+		if board.CurrentTurn == ai.Color && len(ai.StateHistory) > 0 {
+			ai.StateHistory = ai.StateHistory[:len(ai.StateHistory)-1]
 		}
 	}
+	return undone
+}
+
+// newTerminalRecord создает запись партии человека против AI
+func newTerminalRecord(board *game.Board) *pgn.Game {
+	record := pgn.NewGame("Human", "ChessAI")
+	record.SetStartPosition(board)
+	return record
 }
 
 func handleGameOver(board *game.Board, ai *agent.Agent, gamesPlayed *int) {
@@ -157,17 +684,15 @@ func handleGameOver(board *game.Board, ai *agent.Agent, gamesPlayed *int) {
 
 	fmt.Println("\n=== ИГРА ОКОНЧЕНА ===")
 
-	var reward float64
-	if board.Winner == game.Black {
-		fmt.Println("AI победил!")
-		reward = 1.0
-	} else if board.Winner == game.White {
-		fmt.Println("Вы победили!")
-		reward = 0.0
-	} else {
-		fmt.Println("Ничья!")
-		reward = 0.5
+	switch board.Result {
+	case game.BlackWins:
+		fmt.Printf("AI победил! (%s)\n", board.Termination)
+	case game.WhiteWins:
+		fmt.Printf("Вы победили! (%s)\n", board.Termination)
+	default:
+		fmt.Printf("Ничья! (%s)\n", board.Termination)
 	}
+	reward := board.Result.ScoreFor(game.Black)
 
 	fmt.Println("AI обучается на результатах игры...")
 	ai.Learn(reward)
@@ -175,32 +700,3 @@ func handleGameOver(board *game.Board, ai *agent.Agent, gamesPlayed *int) {
 	fmt.Printf("Игр сыграно: %d\n", *gamesPlayed)
 	fmt.Printf("Текущий уровень исследования (epsilon): %.4f\n\n", ai.Epsilon)
 }
-
-func parseMove(input string) game.Move {
-	parts := strings.Fields(input)
-	if len(parts) != 2 {
-		return game.Move{}
-	}
-
-	from := parsePosition(parts[0])
-	to := parsePosition(parts[1])
-
-	return game.Move{From: from, To: to}
-}
-
-func parsePosition(pos string) game.Position {
-	if len(pos) != 2 {
-		return game.Position{-1, -1}
-	}
-
-	col := int(pos[0] - 'a')
-	row := 8 - int(pos[1]-'0')
-
-	return game.Position{Row: row, Col: col}
-}
-
-func posToString(pos game.Position) string {
-	col := string(rune('a' + pos.Col))
-	row := fmt.Sprintf("%d", 8-pos.Row)
-	return col + row
-}
@@ -0,0 +1,89 @@
+package neural
+
+import (
+	"fmt"
+	"math"
+)
+
+// Activation - функция активации слоя
+type Activation string
+
+// Поддерживаемые функции активации
+const (
+	Linear      Activation = "linear"     // Без активации
+	ReLU        Activation = "relu"       // max(0, x)
+	ClippedReLU Activation = "crelu"      // min(max(0, x), 1)
+	LeakyReLU   Activation = "leaky_relu" // x при x > 0, иначе 0.01x
+	Tanh        Activation = "tanh"
+	Sigmoid     Activation = "sigmoid"
+)
+
+// leakySlope - наклон LeakyReLU при отрицательных x
+const leakySlope = 0.01
+
+// activations - все поддерживаемые функции активации
+var activations = []Activation{Linear, ReLU, ClippedReLU, LeakyReLU, Tanh, Sigmoid}
+
+// ParseActivation разбирает название функции активации
+func ParseActivation(s string) (Activation, error) {
+	for _, a := range activations {
+		if string(a) == s {
+			return a, nil
+		}
+	}
+	return "", fmt.Errorf("неизвестная функция активации %q (поддерживаются: %v)", s, activations)
+}
+
+// apply вычисляет активацию от взвешенной суммы x
+func (a Activation) apply(x float64) float64 {
+	switch a {
+	case ReLU:
+		return relu(x)
+	case ClippedReLU:
+		return math.Min(relu(x), 1)
+	case LeakyReLU:
+		if x > 0 {
+			return x
+		}
+		return leakySlope * x
+	case Tanh:
+		return math.Tanh(x)
+	case Sigmoid:
+		return 1 / (1 + math.Exp(-x))
+	}
+	return x
+}
+
+// derivative вычисляет производную активации по взвешенной сумме x,
+// зная значение активации y = apply(x)
+func (a Activation) derivative(x, y float64) float64 {
+	switch a {
+	case ReLU:
+		if x > 0 {
+			return 1
+		}
+		return 0
+	case ClippedReLU:
+		if x > 0 && x < 1 {
+			return 1
+		}
+		return 0
+	case LeakyReLU:
+		if x > 0 {
+			return 1
+		}
+		return leakySlope
+	case Tanh:
+		return 1 - y*y
+	case Sigmoid:
+		return y * (1 - y)
+	}
+	return 1
+}
+
+func relu(x float64) float64 {
+	if x > 0 {
+		return x
+	}
+	return 0
+}
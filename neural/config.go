@@ -0,0 +1,109 @@
+package neural
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// LayerConfig описывает полносвязный слой: количество нейронов и функцию активации
+type LayerConfig struct {
+	Size       int        `json:"size"`
+	Activation Activation `json:"activation"`
+}
+
+// Config - архитектура сети: размер входа и слои от первого скрытого до выходного.
+// Выходной слой состоит из одного нейрона - оценки позиции.
+type Config struct {
+	InputSize int           `json:"inputSize"`
+	Layers    []LayerConfig `json:"layers"`
+}
+
+// DefaultLayers - слои сети по умолчанию: два скрытых слоя с ReLU и выход с tanh
+var DefaultLayers = []LayerConfig{
+	{Size: 256, Activation: ReLU},
+	{Size: 128, Activation: ReLU},
+	{Size: 1, Activation: Tanh},
+}
+
+// DefaultConfig возвращает архитектуру по умолчанию для входа размером inputSize
+func DefaultConfig(inputSize int) Config {
+	return Config{
+		InputSize: inputSize,
+		Layers:    append([]LayerConfig(nil), DefaultLayers...),
+	}
+}
+
+// Validate проверяет, что по архитектуре можно построить сеть
+func (c Config) Validate() error {
+	if c.InputSize <= 0 {
+		return fmt.Errorf("размер входа должен быть больше нуля (указано: %d)", c.InputSize)
+	}
+	if len(c.Layers) == 0 {
+		return fmt.Errorf("в сети нет ни одного слоя")
+	}
+	for i, layer := range c.Layers {
+		if layer.Size <= 0 {
+			return fmt.Errorf("слой %d: размер должен быть больше нуля (указано: %d)", i+1, layer.Size)
+		}
+		if _, err := ParseActivation(string(layer.Activation)); err != nil {
+			return fmt.Errorf("слой %d: %v", i+1, err)
+		}
+	}
+	if out := c.Layers[len(c.Layers)-1].Size; out != 1 {
+		return fmt.Errorf("выходной слой должен состоять из одного нейрона (указано: %d)", out)
+	}
+	return nil
+}
+
+// Equal сравнивает архитектуры
+func (c Config) Equal(other Config) bool {
+	if c.InputSize != other.InputSize || len(c.Layers) != len(other.Layers) {
+		return false
+	}
+	for i := range c.Layers {
+		if c.Layers[i] != other.Layers[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// String записывает архитектуру в виде "768-256:relu-128:relu-1:tanh"
+func (c Config) String() string {
+	parts := []string{strconv.Itoa(c.InputSize)}
+	for _, layer := range c.Layers {
+		parts = append(parts, fmt.Sprintf("%d:%s", layer.Size, layer.Activation))
+	}
+	return strings.Join(parts, "-")
+}
+
+// ParseLayers разбирает список слоев вида "256:relu,128:crelu,1:tanh".
+// Активацию можно опустить: тогда у скрытых слоев будет ReLU, а у выходного tanh.
+func ParseLayers(s string) ([]LayerConfig, error) {
+	var layers []LayerConfig
+	parts := strings.Split(s, ",")
+	for i, part := range parts {
+		sizeStr, activationStr := strings.TrimSpace(part), ""
+		if idx := strings.Index(sizeStr, ":"); idx >= 0 {
+			sizeStr, activationStr = strings.TrimSpace(sizeStr[:idx]), strings.TrimSpace(sizeStr[idx+1:])
+		}
+
+		size, err := strconv.Atoi(sizeStr)
+		if err != nil {
+			return nil, fmt.Errorf("слой %d: неверный размер %q", i+1, sizeStr)
+		}
+
+		activation := ReLU
+		if i == len(parts)-1 {
+			activation = Tanh
+		}
+		if activationStr != "" {
+			if activation, err = ParseActivation(activationStr); err != nil {
+				return nil, fmt.Errorf("слой %d: %v", i+1, err)
+			}
+		}
+		layers = append(layers, LayerConfig{Size: size, Activation: activation})
+	}
+	return layers, nil
+}
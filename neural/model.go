@@ -0,0 +1,249 @@
+package neural
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Формат файла модели:
+//
+//	сигнатура        8 байт "CHESSNN\x00"
+//	версия формата   uint32
+//	длина заголовка  uint32, затем заголовок - ModelInfo в JSON
+//	длина данных     uint64, затем данные в float64:
+//	                 веса слой за слоем - матрица весов по строкам, затем смещения;
+//	                 буферы оптимизатора (если в заголовке optimizerState) - для каждого
+//	                 слота оптимизатора по буферу на каждую строку весов и смещения в том же порядке
+//	контрольная сумма uint32 - CRC-32 всех предыдущих байтов
+//
+// Все числа записываются в порядке little-endian. Версия 1 отличается тем, что
+// вместо оптимизатора в заголовке записан только momentum SGD, а в данных только веса.
+const (
+	// FormatVersion - версия формата, которую записывает Save
+	FormatVersion = 2
+
+	modelMagic = "CHESSNN\x00"
+)
+
+// ModelInfo - сведения о модели из заголовка файла
+type ModelInfo struct {
+	FormatVersion int       `json:"-"`
+	Architecture  Config    `json:"architecture"`
+	InputEncoding string    `json:"inputEncoding"` // Кодировка входа (задается тем, кто кодирует позиции)
+	TrainingSteps uint64    `json:"trainingSteps"` // Количество шагов обучения
+	Created       time.Time `json:"created"`       // Время создания модели (не последнего сохранения)
+	LearningRate  float64   `json:"learningRate"`  // Базовая скорость обучения
+
+	Optimizer      OptimizerConfig `json:"optimizer"`
+	Schedule       Schedule        `json:"schedule"`
+	OptimizerSteps uint64          `json:"optimizerSteps"` // Шагов, сделанных текущим оптимизатором
+	OptimizerState bool            `json:"optimizerState"` // Записаны ли буферы оптимизатора
+}
+
+// Info возвращает сведения о сети для заголовка файла
+func (n *Network) Info() ModelInfo {
+	return ModelInfo{
+		FormatVersion: FormatVersion,
+		Architecture:  n.Config,
+		InputEncoding: n.InputEncoding,
+		TrainingSteps: n.TrainingSteps,
+		Created:       n.Created,
+		LearningRate:  n.LearningRate,
+
+		Optimizer:      n.Optimizer.Config(),
+		Schedule:       n.Schedule,
+		OptimizerSteps: n.Optimizer.State().Steps,
+		OptimizerState: len(n.Optimizer.State().Buffers) > 0,
+	}
+}
+
+// String описывает модель одной строкой
+func (info ModelInfo) String() string {
+	return fmt.Sprintf("архитектура %s, вход %s, шагов обучения %d, оптимизатор %s, скорость %g (%s), создана %s",
+		info.Architecture, info.InputEncoding, info.TrainingSteps, info.Optimizer, info.LearningRate, info.Schedule,
+		info.Created.Format("2006-01-02 15:04:05"))
+}
+
+// Save сохраняет сеть в файл path. Файл сначала записывается рядом под временным
+// именем, поэтому при сбое старая модель не портится.
+func (n *Network) Save(path string) error {
+	header, err := json.Marshal(n.Info())
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(modelMagic)
+	binary.Write(&buf, binary.LittleEndian, uint32(FormatVersion))
+	binary.Write(&buf, binary.LittleEndian, uint32(len(header)))
+	buf.Write(header)
+	params := n.params(nil, nil)
+	buffers := n.Optimizer.State().Buffers
+	binary.Write(&buf, binary.LittleEndian, uint64((1+len(buffers)/len(params))*n.weightCount()*8))
+	for _, p := range params {
+		writeFloats(&buf, p.Values)
+	}
+	for _, b := range buffers {
+		writeFloats(&buf, b)
+	}
+	binary.Write(&buf, binary.LittleEndian, crc32.ChecksumIEEE(buf.Bytes()))
+
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadNetwork загружает сеть из файла path. Файл другого формата, неподдерживаемой
+// версии, поврежденный или с весами, не соответствующими архитектуре, не загружается.
+func LoadNetwork(path string) (*Network, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, payload, err := parseModel(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	n := &Network{
+		Config:        info.Architecture,
+		InputEncoding: info.InputEncoding,
+		TrainingSteps: info.TrainingSteps,
+		Created:       info.Created,
+		LearningRate:  info.LearningRate,
+		Optimizer:     NewOptimizer(info.Optimizer),
+		Schedule:      info.Schedule,
+	}
+	inputs := n.Config.InputSize
+	for _, lc := range n.Config.Layers {
+		n.Layers = append(n.Layers, newLayer(inputs, lc.Size, lc.Activation))
+		inputs = lc.Size
+	}
+	params := n.params(nil, nil)
+	state := n.Optimizer.State()
+	state.Steps = info.OptimizerSteps
+	if info.OptimizerState {
+		state.ensureBuffers(params, info.Optimizer.slots())
+	}
+	if len(payload) != (1+len(state.Buffers)/len(params))*n.weightCount()*8 {
+		return nil, fmt.Errorf("%s: размер данных не соответствует архитектуре %s и оптимизатору %s", path, n.Config, info.Optimizer)
+	}
+
+	r := bytes.NewReader(payload)
+	for _, p := range params {
+		readFloats(r, p.Values)
+	}
+	for _, b := range state.Buffers {
+		readFloats(r, b)
+	}
+	n.initBuffers()
+	return n, nil
+}
+
+// ReadModelInfo читает сведения о модели из файла path без загрузки весов
+func ReadModelInfo(path string) (ModelInfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ModelInfo{}, err
+	}
+	info, _, err := parseModel(data)
+	if err != nil {
+		return ModelInfo{}, fmt.Errorf("%s: %v", path, err)
+	}
+	return info, nil
+}
+
+// parseModel проверяет файл модели и разделяет его на заголовок и веса
+func parseModel(data []byte) (ModelInfo, []byte, error) {
+	var info ModelInfo
+	if len(data) < len(modelMagic)+20 || string(data[:len(modelMagic)]) != modelMagic {
+		return info, nil, fmt.Errorf("не файл модели (неверная сигнатура)")
+	}
+
+	version := binary.LittleEndian.Uint32(data[len(modelMagic):])
+	if version < 1 || version > FormatVersion {
+		return info, nil, fmt.Errorf("версия формата %d не поддерживается (поддерживаются 1-%d)", version, FormatVersion)
+	}
+
+	body, sum := data[:len(data)-4], binary.LittleEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(body) != sum {
+		return info, nil, fmt.Errorf("контрольная сумма не совпадает: файл поврежден")
+	}
+
+	pos := len(modelMagic) + 4
+	headerLen := int(binary.LittleEndian.Uint32(body[pos:]))
+	pos += 4
+	if pos+headerLen+8 > len(body) {
+		return info, nil, fmt.Errorf("файл модели обрезан")
+	}
+	if err := json.Unmarshal(body[pos:pos+headerLen], &info); err != nil {
+		return info, nil, fmt.Errorf("неверный заголовок: %v", err)
+	}
+	info.FormatVersion = int(version)
+	if version == 1 {
+		// В версии 1 сеть всегда обучалась SGD с momentum, состояние которого не сохранялось
+		var legacy struct {
+			Momentum float64 `json:"momentum"`
+		}
+		json.Unmarshal(body[pos:pos+headerLen], &legacy)
+		info.Optimizer = OptimizerConfig{Type: SGD, Momentum: legacy.Momentum}
+		info.Schedule = Schedule{Type: ConstantSchedule}
+	}
+	if err := info.Architecture.Validate(); err != nil {
+		return info, nil, fmt.Errorf("неверная архитектура: %v", err)
+	}
+	if err := info.Optimizer.Validate(); err != nil {
+		return info, nil, fmt.Errorf("неверный оптимизатор: %v", err)
+	}
+	if err := info.Schedule.Validate(); err != nil {
+		return info, nil, err
+	}
+	pos += headerLen
+
+	payloadLen := binary.LittleEndian.Uint64(body[pos:])
+	pos += 8
+	if payloadLen != uint64(len(body)-pos) {
+		return info, nil, fmt.Errorf("размер весов не совпадает с размером файла")
+	}
+	return info, body[pos:], nil
+}
+
+// weightCount возвращает количество весов и смещений сети
+func (n *Network) weightCount() int {
+	count := 0
+	for _, layer := range n.Layers {
+		count += len(layer.Weights)*len(layer.Bias) + len(layer.Bias)
+	}
+	return count
+}
+
+func writeFloats(buf *bytes.Buffer, values []float64) {
+	var b [8]byte
+	for _, v := range values {
+		binary.LittleEndian.PutUint64(b[:], math.Float64bits(v))
+		buf.Write(b[:])
+	}
+}
+
+func readFloats(r *bytes.Reader, values []float64) {
+	var b [8]byte
+	for i := range values {
+		r.Read(b[:])
+		values[i] = math.Float64frombits(binary.LittleEndian.Uint64(b[:]))
+	}
+}
@@ -1,259 +1,318 @@
 package neural
 
 import (
-	"encoding/gob"
 	"math"
 	"math/rand"
-	"os"
+	"sync"
+	"time"
 )
 
-// Network представляет нейронную сеть
+// Layer - полносвязный слой сети
+type Layer struct {
+	Activation Activation
+	Weights    [][]float64 // Weights[i][j] - вес связи входа i с нейроном j
+	Bias       []float64
+}
+
+// Network представляет нейронную сеть из полносвязных слоев
 type Network struct {
-	Weights1 [][]float64 // 768 -> 256
-	Bias1    []float64   // 256
-	Weights2 [][]float64 // 256 -> 128
-	Bias2    []float64   // 128
-	Weights3 [][]float64 // 128 -> 1
-	Bias3    []float64   // 1
-
-	// Для momentum
-	VWeights1 [][]float64
-	VBias1    []float64
-	VWeights2 [][]float64
-	VBias2    []float64
-	VWeights3 [][]float64
-	VBias3    []float64
-
-	LearningRate float64
-	Momentum     float64
+	Config        Config    // Архитектура сети
+	Layers        []*Layer  // Слои от первого скрытого до выходного
+	InputEncoding string    // Кодировка входа, для которой обучена сеть
+	TrainingSteps uint64    // Количество шагов обучения
+	Created       time.Time // Время создания сети
+
+	LearningRate float64   // Базовая скорость обучения
+	Optimizer    Optimizer // Оптимизатор и его состояние
+	Schedule     Schedule  // Расписание скорости обучения по шагам оптимизатора
+
+	buffers   *sync.Pool // Буферы активаций для Forward
+	gradients *gradients // Буферы обучения (nil до первого обучения)
 }
 
-// NewNetwork создает новую нейронную сеть
-func NewNetwork() *Network {
+// NewNetwork создает сеть архитектуры config (должна быть корректной, см. Config.Validate)
+// со случайными весами. Обученную сеть загружает LoadNetwork.
+func NewNetwork(config Config) *Network {
 	n := &Network{
+		Config:       config,
+		Created:      time.Now(),
 		LearningRate: 0.001,
-		Momentum:     0.9,
+		Optimizer:    NewOptimizer(DefaultOptimizer),
+		Schedule:     Schedule{Type: ConstantSchedule},
 	}
 
-	// Инициализация весов (Xavier initialization)
-	n.Weights1 = make([][]float64, 768)
-	n.VWeights1 = make([][]float64, 768)
-	for i := range n.Weights1 {
-		n.Weights1[i] = make([]float64, 256)
-		n.VWeights1[i] = make([]float64, 256)
-		scale := math.Sqrt(2.0 / 768.0)
-		for j := range n.Weights1[i] {
-			n.Weights1[i][j] = (rand.Float64()*2 - 1) * scale
+	// Инициализация весов (He initialization)
+	inputs := config.InputSize
+	for _, lc := range config.Layers {
+		layer := newLayer(inputs, lc.Size, lc.Activation)
+		scale := math.Sqrt(2.0 / float64(inputs))
+		for i := range layer.Weights {
+			for j := range layer.Weights[i] {
+				layer.Weights[i][j] = (rand.Float64()*2 - 1) * scale
+			}
 		}
+		n.Layers = append(n.Layers, layer)
+		inputs = lc.Size
 	}
+	n.initBuffers()
+	return n
+}
 
-	n.Bias1 = make([]float64, 256)
-	n.VBias1 = make([]float64, 256)
-
-	n.Weights2 = make([][]float64, 256)
-	n.VWeights2 = make([][]float64, 256)
-	for i := range n.Weights2 {
-		n.Weights2[i] = make([]float64, 128)
-		n.VWeights2[i] = make([]float64, 128)
-		scale := math.Sqrt(2.0 / 256.0)
-		for j := range n.Weights2[i] {
-			n.Weights2[i][j] = (rand.Float64()*2 - 1) * scale
+// Clone возвращает независимую копию сети
+func (n *Network) Clone() *Network {
+	clone := *n
+	clone.Layers = make([]*Layer, len(n.Layers))
+	for i, layer := range n.Layers {
+		clone.Layers[i] = &Layer{
+			Activation: layer.Activation,
+			Weights:    cloneMatrix(layer.Weights),
+			Bias:       append([]float64(nil), layer.Bias...),
 		}
 	}
+	clone.Optimizer = cloneOptimizer(n.Optimizer)
+	clone.Config.Layers = append([]LayerConfig(nil), n.Config.Layers...)
+	clone.gradients = nil
+	clone.initBuffers()
+	return &clone
+}
 
-	n.Bias2 = make([]float64, 128)
-	n.VBias2 = make([]float64, 128)
-
-	n.Weights3 = make([][]float64, 128)
-	n.VWeights3 = make([][]float64, 128)
-	for i := range n.Weights3 {
-		n.Weights3[i] = make([]float64, 1)
-		n.VWeights3[i] = make([]float64, 1)
-		scale := math.Sqrt(2.0 / 128.0)
-		for j := range n.Weights3[i] {
-			n.Weights3[i][j] = (rand.Float64()*2 - 1) * scale
-		}
+// newLayer создает слой с нулевыми весами
+func newLayer(inputs, outputs int, activation Activation) *Layer {
+	return &Layer{
+		Activation: activation,
+		Weights:    newMatrix(inputs, outputs),
+		Bias:       make([]float64, outputs),
 	}
+}
 
-	n.Bias3 = make([]float64, 1)
-	n.VBias3 = make([]float64, 1)
-
-	// Попытка загрузить сохраненные веса
-	// Сохраняем начальные значения LearningRate и Momentum
-	initialLR := n.LearningRate
-	initialMomentum := n.Momentum
-	
-	if err := n.Load(); err == nil {
-		// Если загрузка успешна, проверяем и восстанавливаем LearningRate и Momentum,
-		// если они были обнулены или имеют неразумные значения
-		if n.LearningRate <= 0 || n.LearningRate > 1.0 {
-			n.LearningRate = initialLR
-		}
-		if n.Momentum <= 0 || n.Momentum > 1.0 {
-			n.Momentum = initialMomentum
-		}
+func newMatrix(rows, cols int) [][]float64 {
+	m := make([][]float64, rows)
+	for i := range m {
+		m[i] = make([]float64, cols)
 	}
+	return m
+}
 
-	return n
+func cloneMatrix(m [][]float64) [][]float64 {
+	clone := make([][]float64, len(m))
+	for i := range m {
+		clone[i] = append([]float64(nil), m[i]...)
+	}
+	return clone
 }
 
-// Forward выполняет прямое распространение
-func (n *Network) Forward(input []float64) float64 {
-	// Слой 1: 768 -> 256 с ReLU
-	hidden1 := make([]float64, 256)
-	for i := 0; i < 256; i++ {
-		sum := n.Bias1[i]
-		for j := 0; j < 768; j++ {
-			sum += input[j] * n.Weights1[j][i]
-		}
-		hidden1[i] = relu(sum)
+// initBuffers создает пул буферов активаций под текущие слои. Forward вызывается
+// в каждой позиции поиска, в том числе из нескольких потоков одновременно.
+func (n *Network) initBuffers() {
+	sizes := make([]int, len(n.Layers))
+	for i, layer := range n.Layers {
+		sizes[i] = len(layer.Bias)
+	}
+	n.buffers = &sync.Pool{
+		New: func() interface{} {
+			buf := make([][]float64, len(sizes))
+			for i, size := range sizes {
+				buf[i] = make([]float64, size)
+			}
+			return buf
+		},
 	}
+}
 
-	// Слой 2: 256 -> 128 с ReLU
-	hidden2 := make([]float64, 128)
-	for i := 0; i < 128; i++ {
-		sum := n.Bias2[i]
-		for j := 0; j < 256; j++ {
-			sum += hidden1[j] * n.Weights2[j][i]
+// forward вычисляет активации слоя out по входу x. Если sums не nil, туда
+// записываются взвешенные суммы до активации (они нужны при обучении).
+// Веса перебираются по строкам, а нулевые входы пропускаются: на доске
+// не больше 32 фигур, и большинство входов первого слоя равны нулю.
+func (l *Layer) forward(x, sums, out []float64) {
+	copy(out, l.Bias)
+	for i, xi := range x {
+		if xi == 0 {
+			continue
+		}
+		for j, w := range l.Weights[i] {
+			out[j] += xi * w
+		}
+	}
+	for j, s := range out {
+		if sums != nil {
+			sums[j] = s
 		}
-		hidden2[i] = relu(sum)
+		out[j] = l.Activation.apply(s)
 	}
+}
+
+// Forward выполняет прямое распространение. Сеть при этом не изменяется, поэтому
+// Forward можно вызывать из нескольких горутин одновременно (но не вместе с обучением).
+func (n *Network) Forward(input []float64) float64 {
+	buf := n.buffers.Get().([][]float64)
+	defer n.buffers.Put(buf)
 
-	// Выходной слой: 128 -> 1 с tanh
-	sum := n.Bias3[0]
-	for j := 0; j < 128; j++ {
-		sum += hidden2[j] * n.Weights3[j][0]
+	x := input
+	for i, layer := range n.Layers {
+		layer.forward(x, nil, buf[i])
+		x = buf[i]
 	}
+	return x[0]
+}
+
+// gradients - накопленные градиенты и буферы обратного распространения.
+// Создаются при первом обучении и используются повторно.
+type gradients struct {
+	sums    [][]float64 // Взвешенные суммы слоев для текущего примера
+	outputs [][]float64 // Активации слоев для текущего примера
+	deltas  [][]float64 // Ошибки слоев для текущего примера
 
-	return tanh(sum)
+	weights [][][]float64 // Сумма градиентов весов по примерам пакета
+	bias    [][]float64   // Сумма градиентов смещений по примерам пакета
+	samples int           // Количество накопленных примеров
+
+	params []Param // Параметры сети с градиентами для оптимизатора
 }
 
-// Train обучает сеть на одном примере
-func (n *Network) Train(input []float64, target float64) {
-	// Forward pass с сохранением активаций
-	hidden1 := make([]float64, 256)
-	for i := 0; i < 256; i++ {
-		sum := n.Bias1[i]
-		for j := 0; j < 768; j++ {
-			sum += input[j] * n.Weights1[j][i]
-		}
-		hidden1[i] = relu(sum)
+// grads возвращает буферы обучения, создавая их при первом вызове
+func (n *Network) grads() *gradients {
+	if n.gradients != nil {
+		return n.gradients
 	}
-
-	hidden2 := make([]float64, 128)
-	for i := 0; i < 128; i++ {
-		sum := n.Bias2[i]
-		for j := 0; j < 256; j++ {
-			sum += hidden1[j] * n.Weights2[j][i]
-		}
-		hidden2[i] = relu(sum)
+	g := &gradients{}
+	for _, layer := range n.Layers {
+		size := len(layer.Bias)
+		g.sums = append(g.sums, make([]float64, size))
+		g.outputs = append(g.outputs, make([]float64, size))
+		g.deltas = append(g.deltas, make([]float64, size))
+		g.weights = append(g.weights, newMatrix(len(layer.Weights), size))
+		g.bias = append(g.bias, make([]float64, size))
 	}
+	g.params = n.params(g.weights, g.bias)
+	n.gradients = g
+	return g
+}
+
+// Train обучает сеть на одном примере
+func (n *Network) Train(input []float64, target float64) {
+	n.accumulate(input, target)
+	n.step()
+}
 
-	sum := n.Bias3[0]
-	for j := 0; j < 128; j++ {
-		sum += hidden2[j] * n.Weights3[j][0]
+// accumulate выполняет прямой и обратный проход для одного примера и добавляет
+// его градиенты к накопленным. Веса не меняются до вызова step.
+// Возвращает квадрат ошибки выхода.
+func (n *Network) accumulate(input []float64, target float64) float64 {
+	g := n.grads()
+	g.samples++
+
+	// Forward pass с сохранением взвешенных сумм и активаций каждого слоя
+	x := input
+	for i, layer := range n.Layers {
+		layer.forward(x, g.sums[i], g.outputs[i])
+		x = g.outputs[i]
 	}
-	output := tanh(sum)
 
 	// Backward pass
 	// Ошибка выходного слоя
-	outputError := target - output
-	outputDelta := outputError * tanhDerivative(sum)
-
-	// Обновление весов выходного слоя с momentum
-	for j := 0; j < 128; j++ {
-		grad := outputDelta * hidden2[j]
-		n.VWeights3[j][0] = n.Momentum*n.VWeights3[j][0] + n.LearningRate*grad
-		n.Weights3[j][0] += n.VWeights3[j][0]
-	}
-	n.VBias3[0] = n.Momentum*n.VBias3[0] + n.LearningRate*outputDelta
-	n.Bias3[0] += n.VBias3[0]
-
-	// Ошибка второго скрытого слоя
-	hidden2Error := make([]float64, 128)
-	for i := 0; i < 128; i++ {
-		hidden2Error[i] = outputDelta * n.Weights3[i][0]
-		if hidden2[i] <= 0 {
-			hidden2Error[i] = 0 // ReLU derivative
+	last := len(n.Layers) - 1
+	output := g.outputs[last][0]
+	g.deltas[last][0] = (target - output) * n.Layers[last].Activation.derivative(g.sums[last][0], output)
+
+	for l := last; l >= 0; l-- {
+		layer := n.Layers[l]
+		delta := g.deltas[l]
+		in := input
+		if l > 0 {
+			in = g.outputs[l-1]
 		}
-	}
 
-	// Обновление весов второго слоя
-	for i := 0; i < 256; i++ {
-		for j := 0; j < 128; j++ {
-			grad := hidden2Error[j] * hidden1[i]
-			n.VWeights2[i][j] = n.Momentum*n.VWeights2[i][j] + n.LearningRate*grad
-			n.Weights2[i][j] += n.VWeights2[i][j]
+		// Градиенты весов слоя. Нулевые входы (а их большинство у первого слоя) пропускаются.
+		for i, xi := range in {
+			if xi == 0 {
+				continue
+			}
+			row := g.weights[l][i]
+			for j, d := range delta {
+				row[j] += d * xi
+			}
 		}
-	}
-	for j := 0; j < 128; j++ {
-		n.VBias2[j] = n.Momentum*n.VBias2[j] + n.LearningRate*hidden2Error[j]
-		n.Bias2[j] += n.VBias2[j]
-	}
-
-	// Ошибка первого скрытого слоя
-	hidden1Error := make([]float64, 256)
-	for i := 0; i < 256; i++ {
-		for j := 0; j < 128; j++ {
-			hidden1Error[i] += hidden2Error[j] * n.Weights2[i][j]
-		}
-		if hidden1[i] <= 0 {
-			hidden1Error[i] = 0 // ReLU derivative
+		for j, d := range delta {
+			g.bias[l][j] += d
 		}
-	}
 
-	// Обновление весов первого слоя
-	for i := 0; i < 768; i++ {
-		for j := 0; j < 256; j++ {
-			grad := hidden1Error[j] * input[i]
-			n.VWeights1[i][j] = n.Momentum*n.VWeights1[i][j] + n.LearningRate*grad
-			n.Weights1[i][j] += n.VWeights1[i][j]
+		// Ошибка предыдущего слоя
+		if l > 0 {
+			prev := n.Layers[l-1]
+			for i := range in {
+				sum := 0.0
+				for j, d := range delta {
+					sum += d * layer.Weights[i][j]
+				}
+				g.deltas[l-1][i] = sum * prev.Activation.derivative(g.sums[l-1][i], in[i])
+			}
 		}
 	}
-	for j := 0; j < 256; j++ {
-		n.VBias1[j] = n.Momentum*n.VBias1[j] + n.LearningRate*hidden1Error[j]
-		n.Bias1[j] += n.VBias1[j]
-	}
+
+	diff := target - output
+	return diff * diff
 }
 
-// Save сохраняет веса сети
-func (n *Network) Save() error {
-	os.MkdirAll("neural", 0755)
-	file, err := os.Create("neural/weights.gob")
-	if err != nil {
-		return err
+// params перечисляет параметры сети в порядке записи в файл модели: по слоям
+// строки матрицы весов, затем смещения. grads - градиенты тех же размеров (могут быть nil).
+func (n *Network) params(weights [][][]float64, bias [][]float64) []Param {
+	var params []Param
+	for l, layer := range n.Layers {
+		for i, row := range layer.Weights {
+			p := Param{Values: row, Decay: true}
+			if weights != nil {
+				p.Grads = weights[l][i]
+			}
+			params = append(params, p)
+		}
+		p := Param{Values: layer.Bias}
+		if bias != nil {
+			p.Grads = bias[l]
+		}
+		params = append(params, p)
 	}
-	defer file.Close()
-
-	encoder := gob.NewEncoder(file)
-	return encoder.Encode(n)
+	return params
 }
 
-// Load загружает веса сети
-func (n *Network) Load() error {
-	file, err := os.Open("neural/weights.gob")
-	if err != nil {
-		return err
+// step делает один шаг оптимизатора по среднему градиенту накопленных примеров
+// и обнуляет накопленные градиенты
+func (n *Network) step() {
+	g := n.grads()
+	if g.samples == 0 {
+		return
+	}
+	n.TrainingSteps++
+
+	// accumulate накапливает направление уменьшения ошибки, а оптимизатору нужен
+	// средний градиент функции потерь, то есть то же с обратным знаком
+	scale := -1 / float64(g.samples)
+	for _, p := range g.params {
+		for i := range p.Grads {
+			p.Grads[i] *= scale
+		}
 	}
-	defer file.Close()
 
-	decoder := gob.NewDecoder(file)
-	return decoder.Decode(n)
-}
+	n.Optimizer.Step(g.params, n.Schedule.Rate(n.LearningRate, n.Optimizer.State().Steps))
 
-// Активационные функции
-func relu(x float64) float64 {
-	if x > 0 {
-		return x
+	for _, p := range g.params {
+		for i := range p.Grads {
+			p.Grads[i] = 0
+		}
 	}
-	return 0
-}
-
-func tanh(x float64) float64 {
-	return math.Tanh(x)
+	g.samples = 0
 }
 
-func tanhDerivative(x float64) float64 {
-	t := math.Tanh(x)
-	return 1 - t*t
+// SetOptimizer задает параметры оптимизатора сети. Если тип оптимизатора не меняется,
+// его состояние сохраняется. Иначе состояние прежнего оптимизатора (накопленный
+// momentum, моменты Adam) теряется, а расписание начинается сначала.
+func (n *Network) SetOptimizer(config OptimizerConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	optimizer := NewOptimizer(config)
+	if n.Optimizer != nil && n.Optimizer.Config().Type == config.Type {
+		*optimizer.State() = *n.Optimizer.State()
+	}
+	n.Optimizer = optimizer
+	return nil
 }
@@ -0,0 +1,216 @@
+package neural
+
+import (
+	"fmt"
+	"math"
+)
+
+// OptimizerType - алгоритм оптимизации
+type OptimizerType string
+
+// Поддерживаемые оптимизаторы
+const (
+	SGD      OptimizerType = "sgd"      // Градиентный спуск с momentum
+	Nesterov OptimizerType = "nesterov" // Градиентный спуск с momentum Нестерова
+	Adam     OptimizerType = "adam"     // Adam; weight decay добавляется к градиенту (L2)
+	AdamW    OptimizerType = "adamw"    // Adam с weight decay, отделенным от градиента
+)
+
+// optimizerTypes - все поддерживаемые оптимизаторы
+var optimizerTypes = []OptimizerType{SGD, Nesterov, Adam, AdamW}
+
+// ParseOptimizerType разбирает название оптимизатора
+func ParseOptimizerType(s string) (OptimizerType, error) {
+	for _, t := range optimizerTypes {
+		if string(t) == s {
+			return t, nil
+		}
+	}
+	return "", fmt.Errorf("неизвестный оптимизатор %q (поддерживаются: %v)", s, optimizerTypes)
+}
+
+// OptimizerConfig - параметры оптимизатора. Сохраняется в заголовке файла модели.
+type OptimizerConfig struct {
+	Type        OptimizerType `json:"type"`
+	Momentum    float64       `json:"momentum,omitempty"`    // Для SGD и Nesterov
+	Beta1       float64       `json:"beta1,omitempty"`       // Для Adam и AdamW
+	Beta2       float64       `json:"beta2,omitempty"`       // Для Adam и AdamW
+	Epsilon     float64       `json:"epsilon,omitempty"`     // Для Adam и AdamW
+	WeightDecay float64       `json:"weightDecay,omitempty"` // Коэффициент затухания весов (к смещениям не применяется)
+}
+
+// DefaultOptimizer - оптимизатор по умолчанию: SGD с momentum 0.9
+var DefaultOptimizer = OptimizerConfig{Type: SGD, Momentum: 0.9}
+
+// DefaultOptimizerConfig возвращает параметры по умолчанию для оптимизатора t
+func DefaultOptimizerConfig(t OptimizerType) OptimizerConfig {
+	switch t {
+	case Adam, AdamW:
+		return OptimizerConfig{Type: t, Beta1: 0.9, Beta2: 0.999, Epsilon: 1e-8}
+	}
+	return OptimizerConfig{Type: t, Momentum: 0.9}
+}
+
+// Validate проверяет параметры оптимизатора
+func (c OptimizerConfig) Validate() error {
+	if _, err := ParseOptimizerType(string(c.Type)); err != nil {
+		return err
+	}
+	if c.Momentum < 0 || c.Momentum >= 1 {
+		return fmt.Errorf("momentum должен быть в диапазоне [0, 1) (указано: %g)", c.Momentum)
+	}
+	if c.Type == Adam || c.Type == AdamW {
+		if c.Beta1 < 0 || c.Beta1 >= 1 || c.Beta2 < 0 || c.Beta2 >= 1 {
+			return fmt.Errorf("beta1 и beta2 должны быть в диапазоне [0, 1) (указано: %g, %g)", c.Beta1, c.Beta2)
+		}
+		if c.Epsilon <= 0 {
+			return fmt.Errorf("epsilon должен быть больше нуля (указано: %g)", c.Epsilon)
+		}
+	}
+	if c.WeightDecay < 0 {
+		return fmt.Errorf("weight decay не может быть отрицательным (указано: %g)", c.WeightDecay)
+	}
+	return nil
+}
+
+// slots возвращает количество буферов состояния оптимизатора на один параметр
+func (c OptimizerConfig) slots() int {
+	if c.Type == Adam || c.Type == AdamW {
+		return 2
+	}
+	return 1
+}
+
+// String описывает оптимизатор одной строкой
+func (c OptimizerConfig) String() string {
+	s := string(c.Type)
+	switch c.Type {
+	case SGD, Nesterov:
+		s += fmt.Sprintf(" (momentum %g", c.Momentum)
+	default:
+		s += fmt.Sprintf(" (beta1 %g, beta2 %g", c.Beta1, c.Beta2)
+	}
+	if c.WeightDecay > 0 {
+		s += fmt.Sprintf(", weight decay %g", c.WeightDecay)
+	}
+	return s + ")"
+}
+
+// Param - вектор параметров сети (строка матрицы весов или смещения слоя) и градиент
+// функции потерь по нему
+type Param struct {
+	Values []float64
+	Grads  []float64
+	Decay  bool // Применять ли к параметрам weight decay
+}
+
+// OptimizerState - состояние оптимизатора, которое сохраняется вместе с весами
+type OptimizerState struct {
+	Steps   uint64      // Количество сделанных шагов
+	Buffers [][]float64 // Буферы: для каждого слота по буферу на каждый параметр, в порядке параметров
+}
+
+// Optimizer обновляет параметры сети по градиентам
+type Optimizer interface {
+	// Step делает один шаг оптимизации со скоростью обучения rate
+	Step(params []Param, rate float64)
+	// Config возвращает параметры оптимизатора
+	Config() OptimizerConfig
+	// State возвращает состояние оптимизатора. Буферы создаются при первом шаге.
+	State() *OptimizerState
+}
+
+// NewOptimizer создает оптимизатор по параметрам config (должны быть корректны, см. OptimizerConfig.Validate)
+func NewOptimizer(config OptimizerConfig) Optimizer {
+	switch config.Type {
+	case Adam, AdamW:
+		return &adam{config: config}
+	}
+	return &sgd{config: config}
+}
+
+// cloneOptimizer возвращает оптимизатор с теми же параметрами и копией состояния
+func cloneOptimizer(o Optimizer) Optimizer {
+	clone := NewOptimizer(o.Config())
+	state := o.State()
+	*clone.State() = OptimizerState{Steps: state.Steps, Buffers: cloneMatrix(state.Buffers)}
+	return clone
+}
+
+// ensureBuffers создает буферы состояния под параметры params, если их еще нет
+func (s *OptimizerState) ensureBuffers(params []Param, slots int) {
+	if len(s.Buffers) == slots*len(params) {
+		return
+	}
+	s.Buffers = make([][]float64, 0, slots*len(params))
+	for slot := 0; slot < slots; slot++ {
+		for _, p := range params {
+			s.Buffers = append(s.Buffers, make([]float64, len(p.Values)))
+		}
+	}
+}
+
+// sgd - градиентный спуск с momentum (в том числе Нестерова) и L2-регуляризацией
+type sgd struct {
+	config OptimizerConfig
+	state  OptimizerState
+}
+
+func (o *sgd) Config() OptimizerConfig { return o.config }
+func (o *sgd) State() *OptimizerState  { return &o.state }
+
+func (o *sgd) Step(params []Param, rate float64) {
+	o.state.ensureBuffers(params, 1)
+	o.state.Steps++
+	mu := o.config.Momentum
+	for k, p := range params {
+		velocity := o.state.Buffers[k]
+		for i, g := range p.Grads {
+			if p.Decay {
+				g += o.config.WeightDecay * p.Values[i]
+			}
+			velocity[i] = mu*velocity[i] + g
+			if o.config.Type == Nesterov {
+				g += mu * velocity[i]
+			} else {
+				g = velocity[i]
+			}
+			p.Values[i] -= rate * g
+		}
+	}
+}
+
+// adam - Adam и AdamW
+type adam struct {
+	config OptimizerConfig
+	state  OptimizerState
+}
+
+func (o *adam) Config() OptimizerConfig { return o.config }
+func (o *adam) State() *OptimizerState  { return &o.state }
+
+func (o *adam) Step(params []Param, rate float64) {
+	o.state.ensureBuffers(params, 2)
+	o.state.Steps++
+	b1, b2 := o.config.Beta1, o.config.Beta2
+	// Поправки на смещение моментов к нулю в начале обучения
+	c1 := 1 - math.Pow(b1, float64(o.state.Steps))
+	c2 := 1 - math.Pow(b2, float64(o.state.Steps))
+	decoupled := o.config.Type == AdamW
+
+	for k, p := range params {
+		m, v := o.state.Buffers[k], o.state.Buffers[len(params)+k]
+		for i, g := range p.Grads {
+			if p.Decay && o.config.WeightDecay > 0 {
+				if decoupled {
+					p.Values[i] -= rate * o.config.WeightDecay * p.Values[i]
+				} else {
+					g += o.config.WeightDecay * p.Values[i]
+				}
+			}
+			m[i] = b1*m[i] + (1-b1)*g
+			v[i] = b2*v[i] + (1-b2)*g*g
+			p.Values[i] -= rate * (m[i] / c1) / (math.Sqrt(v[i]/c2) + o.config.Epsilon)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package neural
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ScheduleType - способ изменения скорости обучения по ходу обучения
+type ScheduleType string
+
+// Поддерживаемые расписания скорости обучения
+const (
+	ConstantSchedule ScheduleType = "constant" // Постоянная скорость
+	StepSchedule     ScheduleType = "step"     // Умножение на Gamma каждые StepSize шагов
+	CosineSchedule   ScheduleType = "cosine"   // Косинусное снижение до MinRate за TotalSteps шагов
+)
+
+// Schedule - расписание скорости обучения. Сохраняется в заголовке файла модели.
+type Schedule struct {
+	Type       ScheduleType `json:"type"`
+	Warmup     uint64       `json:"warmup,omitempty"`     // Шагов линейного разогрева от нуля до базовой скорости
+	StepSize   uint64       `json:"stepSize,omitempty"`   // Для step: период снижения в шагах
+	Gamma      float64      `json:"gamma,omitempty"`      // Для step: множитель скорости
+	TotalSteps uint64       `json:"totalSteps,omitempty"` // Для cosine: длина снижения в шагах (после разогрева)
+	MinRate    float64      `json:"minRate,omitempty"`    // Для cosine: минимальная скорость в долях базовой
+}
+
+// Rate возвращает скорость обучения на шаге step (шаги считаются с нуля)
+// при базовой скорости base
+func (s Schedule) Rate(base float64, step uint64) float64 {
+	if step < s.Warmup {
+		return base * float64(step+1) / float64(s.Warmup)
+	}
+	step -= s.Warmup
+
+	switch s.Type {
+	case StepSchedule:
+		if s.StepSize > 0 {
+			return base * math.Pow(s.Gamma, float64(step/s.StepSize))
+		}
+	case CosineSchedule:
+		if s.TotalSteps > 0 {
+			progress := math.Min(float64(step)/float64(s.TotalSteps), 1)
+			return base * (s.MinRate + (1-s.MinRate)*(1+math.Cos(math.Pi*progress))/2)
+		}
+	}
+	return base
+}
+
+// Validate проверяет параметры расписания
+func (s Schedule) Validate() error {
+	switch s.Type {
+	case ConstantSchedule, "":
+	case StepSchedule:
+		if s.StepSize == 0 || s.Gamma <= 0 {
+			return fmt.Errorf("расписание step: период и множитель должны быть больше нуля")
+		}
+	case CosineSchedule:
+		if s.TotalSteps == 0 || s.MinRate < 0 || s.MinRate > 1 {
+			return fmt.Errorf("расписание cosine: длина должна быть больше нуля, а минимальная скорость - от 0 до 1")
+		}
+	default:
+		return fmt.Errorf("неизвестное расписание скорости обучения %q", s.Type)
+	}
+	return nil
+}
+
+// String записывает расписание в виде, который понимает ParseSchedule
+func (s Schedule) String() string {
+	var str string
+	switch s.Type {
+	case StepSchedule:
+		str = fmt.Sprintf("step:%d:%g", s.StepSize, s.Gamma)
+	case CosineSchedule:
+		str = fmt.Sprintf("cosine:%d:%g", s.TotalSteps, s.MinRate)
+	default:
+		str = string(ConstantSchedule)
+	}
+	if s.Warmup > 0 {
+		str += fmt.Sprintf(",warmup:%d", s.Warmup)
+	}
+	return str
+}
+
+// ParseSchedule разбирает расписание вида "constant", "step:10000:0.5" (период и множитель)
+// или "cosine:100000:0.01" (длина и минимальная доля скорости, по умолчанию 0).
+// Через запятую можно добавить разогрев: "cosine:100000,warmup:1000".
+func ParseSchedule(str string) (Schedule, error) {
+	var s Schedule
+	for _, part := range strings.Split(str, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ":")
+		args := fields[1:]
+		var err error
+		switch fields[0] {
+		case "constant":
+			s.Type = ConstantSchedule
+			if len(args) != 0 {
+				err = fmt.Errorf("у расписания constant нет параметров")
+			}
+		case "step":
+			s.Type = StepSchedule
+			if len(args) != 2 {
+				err = fmt.Errorf("ожидается step:период:множитель")
+			} else if s.StepSize, err = strconv.ParseUint(args[0], 10, 64); err == nil {
+				s.Gamma, err = strconv.ParseFloat(args[1], 64)
+			}
+		case "cosine":
+			s.Type = CosineSchedule
+			if len(args) < 1 || len(args) > 2 {
+				err = fmt.Errorf("ожидается cosine:длина или cosine:длина:минимум")
+			} else if s.TotalSteps, err = strconv.ParseUint(args[0], 10, 64); err == nil && len(args) == 2 {
+				s.MinRate, err = strconv.ParseFloat(args[1], 64)
+			}
+		case "warmup":
+			if len(args) != 1 {
+				err = fmt.Errorf("ожидается warmup:шагов")
+			} else {
+				s.Warmup, err = strconv.ParseUint(args[0], 10, 64)
+			}
+		default:
+			err = fmt.Errorf("неизвестное расписание %q (поддерживаются: constant, step, cosine, warmup)", fields[0])
+		}
+		if err != nil {
+			return Schedule{}, fmt.Errorf("неверное расписание скорости обучения %q: %v", str, err)
+		}
+	}
+	if s.Type == "" {
+		s.Type = ConstantSchedule
+	}
+	return s, s.Validate()
+}
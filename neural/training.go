@@ -1,13 +1,172 @@
 package neural
 
-// TrainBatch обучает сеть на пакете данных
-func (n *Network) TrainBatch(inputs [][]float64, targets []float64) {
+import "math/rand"
+
+// Dataset - набор обучающих примеров: входы сети и целевые оценки
+type Dataset struct {
+	Inputs  [][]float64
+	Targets []float64
+}
+
+// Add добавляет пример в набор
+func (d *Dataset) Add(input []float64, target float64) {
+	d.Inputs = append(d.Inputs, input)
+	d.Targets = append(d.Targets, target)
+}
+
+// Len возвращает количество примеров
+func (d *Dataset) Len() int {
+	return len(d.Inputs)
+}
+
+// Shuffle перемешивает примеры. Если r равен nil, используется общий генератор.
+func (d *Dataset) Shuffle(r *rand.Rand) {
+	swap := func(i, j int) {
+		d.Inputs[i], d.Inputs[j] = d.Inputs[j], d.Inputs[i]
+		d.Targets[i], d.Targets[j] = d.Targets[j], d.Targets[i]
+	}
+	if r == nil {
+		rand.Shuffle(d.Len(), swap)
+	} else {
+		r.Shuffle(d.Len(), swap)
+	}
+}
+
+// Split делит набор на обучающий и проверочный: в проверочный попадает доля
+// fraction последних примеров. Наборы используют общие входы, копии не создаются.
+func (d *Dataset) Split(fraction float64) (train, validation *Dataset) {
+	n := d.Len() - int(float64(d.Len())*fraction)
+	if n < 0 {
+		n = 0
+	} else if n > d.Len() {
+		n = d.Len()
+	}
+	train = &Dataset{Inputs: d.Inputs[:n], Targets: d.Targets[:n]}
+	validation = &Dataset{Inputs: d.Inputs[n:], Targets: d.Targets[n:]}
+	return train, validation
+}
+
+// TrainBatch обучает сеть на пакете данных: градиенты всех примеров суммируются,
+// и веса обновляются одним шагом по среднему градиенту.
+// Возвращает среднюю квадратичную ошибку на пакете до обновления весов.
+func (n *Network) TrainBatch(inputs [][]float64, targets []float64) float64 {
+	if len(inputs) == 0 {
+		return 0
+	}
+
+	loss := 0.0
+	for i := range inputs {
+		loss += n.accumulate(inputs[i], targets[i])
+	}
+	n.step()
+	return loss / float64(len(inputs))
+}
+
+// TrainEpoch проходит по набору один раз пакетами по batchSize примеров
+// в текущем порядке примеров. Возвращает среднюю квадратичную ошибку за эпоху.
+func (n *Network) TrainEpoch(data *Dataset, batchSize int) float64 {
+	if data.Len() == 0 {
+		return 0
+	}
+	if batchSize < 1 {
+		batchSize = 1
+	}
+
+	loss := 0.0
+	for start := 0; start < data.Len(); start += batchSize {
+		end := start + batchSize
+		if end > data.Len() {
+			end = data.Len()
+		}
+		loss += n.TrainBatch(data.Inputs[start:end], data.Targets[start:end]) * float64(end-start)
+	}
+	return loss / float64(data.Len())
+}
+
+// TrainEpochs обучает сеть epochs эпох, перемешивая набор перед каждой эпохой,
+// если shuffle равен true. Возвращает ошибку последней эпохи.
+func (n *Network) TrainEpochs(data *Dataset, epochs, batchSize int, shuffle bool) float64 {
+	loss := 0.0
+	for epoch := 0; epoch < epochs; epoch++ {
+		if shuffle {
+			data.Shuffle(nil)
+		}
+		loss = n.TrainEpoch(data, batchSize)
+	}
+	return loss
+}
+
+// FitOptions - параметры обучения с учителем
+type FitOptions struct {
+	Epochs     int    // Количество эпох
+	BatchSize  int    // Размер пакета
+	Shuffle    bool   // Перемешивать ли обучающий набор перед каждой эпохой
+	Checkpoint string // Файл, в который сохраняется лучшая сеть (пустая строка - не сохранять)
+
+	// OnEpoch вызывается после каждой эпохи (может быть nil)
+	OnEpoch func(EpochStats)
+}
+
+// EpochStats - итоги эпохи обучения
+type EpochStats struct {
+	Epoch          int     // Номер эпохи, начиная с единицы
+	TrainLoss      float64 // Средняя квадратичная ошибка на обучающем наборе за эпоху
+	ValidationLoss float64 // Средняя квадратичная ошибка на проверочном наборе после эпохи
+	Accuracy       float64 // Точность на проверочном наборе (см. Evaluate)
+	Best           bool    // Лучшая эпоха на данный момент (по ошибке на проверочном наборе)
+}
+
+// Fit обучает сеть на наборе train, после каждой эпохи оценивая ее на validation.
+// Если проверочный набор пуст, ошибка и точность считаются на обучающем.
+// Сеть лучшей эпохи сохраняется в opts.Checkpoint; после обучения в сети остаются
+// веса последней эпохи. Возвращает итоги лучшей эпохи.
+func (n *Network) Fit(train, validation *Dataset, opts FitOptions) (EpochStats, error) {
+	if validation == nil || validation.Len() == 0 {
+		validation = train
+	}
+
+	var best EpochStats
+	for epoch := 1; epoch <= opts.Epochs; epoch++ {
+		if opts.Shuffle {
+			train.Shuffle(nil)
+		}
+		stats := EpochStats{Epoch: epoch, TrainLoss: n.TrainEpoch(train, opts.BatchSize)}
+		stats.ValidationLoss = n.Loss(validation.Inputs, validation.Targets)
+		stats.Accuracy = n.Evaluate(validation.Inputs, validation.Targets)
+
+		if best.Epoch == 0 || stats.ValidationLoss < best.ValidationLoss {
+			stats.Best = true
+			best = stats
+			if opts.Checkpoint != "" {
+				if err := n.Save(opts.Checkpoint); err != nil {
+					return best, err
+				}
+			}
+		}
+		if opts.OnEpoch != nil {
+			opts.OnEpoch(stats)
+		}
+	}
+	return best, nil
+}
+
+// Loss вычисляет среднюю квадратичную ошибку сети на наборе данных
+func (n *Network) Loss(inputs [][]float64, targets []float64) float64 {
+	if len(inputs) == 0 {
+		return 0
+	}
+
+	loss := 0.0
 	for i := range inputs {
-		n.Train(inputs[i], targets[i])
+		diff := targets[i] - n.Forward(inputs[i])
+		loss += diff * diff
 	}
+	return loss / float64(len(inputs))
 }
 
-// Evaluate оценивает точность сети
+// Evaluate оценивает точность сети на оценках от 0 до 1 (1 - победа, 0.5 - ничья,
+// 0 - поражение): долю примеров, в которых выход сети и целевая оценка лежат по одну
+// сторону от 0.5, то есть сеть верно предсказывает, ждет ли сторону победа
 func (n *Network) Evaluate(inputs [][]float64, targets []float64) float64 {
 	if len(inputs) == 0 {
 		return 0
@@ -17,7 +176,7 @@ func (n *Network) Evaluate(inputs [][]float64, targets []float64) float64 {
 	for i := range inputs {
 		output := n.Forward(inputs[i])
 		predicted := 0.0
-		if output > 0 {
+		if output > 0.5 {
 			predicted = 1.0
 		}
 		if (predicted > 0.5 && targets[i] > 0.5) || (predicted <= 0.5 && targets[i] <= 0.5) {
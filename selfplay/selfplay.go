@@ -4,6 +4,10 @@ import (
 	"chess-ai/agent"
 	"chess-ai/database"
 	"chess-ai/game"
+	"chess-ai/game/pgn"
+	"chess-ai/game/polyglot"
+	"chess-ai/neural"
+	"context"
 	"fmt"
 	"time"
 )
@@ -14,6 +18,11 @@ type SelfPlayManager struct {
 	blackAgent *agent.Agent
 	db         *database.Database
 	gamesCount int
+
+	// StartFEN задает начальную позицию партий (пустая строка - стандартная)
+	StartFEN string
+	// PGNPath - файл, в который дописываются сыгранные партии (пустая строка - не сохранять)
+	PGNPath string
 }
 
 // NewSelfPlayManager создает новый менеджер самообучения
@@ -24,6 +33,10 @@ func NewSelfPlayManager(db *database.Database) *SelfPlayManager {
 	// Оба агента должны использовать одну и ту же нейросеть
 	// чтобы обучаться на опыте друг друга
 	blackAgent.Network = whiteAgent.Network
+	whiteAgent.Limits = agent.SelfPlaySearchLimits
+	blackAgent.Limits = agent.SelfPlaySearchLimits
+	whiteAgent.Explore = true
+	blackAgent.Explore = true
 
 	// Настраиваем базу данных для агентов
 	whiteAgent.SetDatabase(db, true)
@@ -37,10 +50,59 @@ func NewSelfPlayManager(db *database.Database) *SelfPlayManager {
 	}
 }
 
+// SetThreads задает количество потоков поиска обоих агентов
+func (m *SelfPlayManager) SetThreads(threads int) {
+	m.whiteAgent.Threads = threads
+	m.blackAgent.Threads = threads
+}
+
+// SetModelPath задает файл модели, в который сохраняется общая нейросеть агентов
+func (m *SelfPlayManager) SetModelPath(path string) {
+	m.whiteAgent.ModelPath = path
+	m.blackAgent.ModelPath = path
+}
+
+// Load загружает общую нейросеть агентов из файла модели
+func (m *SelfPlayManager) Load() error {
+	if err := m.whiteAgent.Load(); err != nil {
+		return err
+	}
+	m.blackAgent.Network = m.whiteAgent.Network
+	return nil
+}
+
+// Network возвращает общую нейросеть агентов
+func (m *SelfPlayManager) Network() *neural.Network {
+	return m.whiteAgent.Network
+}
+
+// SetBook задает дебютную книгу обоих агентов. При случайном выборе ходов
+// из книги партии начинаются с разных дебютов.
+func (m *SelfPlayManager) SetBook(book *polyglot.Book) {
+	m.whiteAgent.Book = book
+	m.blackAgent.Book = book
+}
+
 // PlayGame запускает одну игру между двумя агентами
 func (m *SelfPlayManager) PlayGame(verbose bool) error {
 	board := game.NewBoard()
+	if m.StartFEN != "" {
+		var err error
+		board, err = game.ParseFEN(m.StartFEN)
+		if err != nil {
+			return fmt.Errorf("ошибка в начальной позиции: %v", err)
+		}
+	}
 	m.gamesCount++
+	m.whiteAgent.NewGame()
+	m.blackAgent.NewGame()
+
+	// Партия в формате PGN для внешних программ просмотра
+	record := pgn.NewGame("ChessAI (white)", "ChessAI (black)")
+	record.Tags["Event"] = "Chess AI self-play"
+	record.Tags["Round"] = fmt.Sprintf("%d", m.gamesCount)
+	record.SetStartPosition(board)
+	record.SetEpsilon(m.whiteAgent.Epsilon, m.blackAgent.Epsilon)
 
 	// Записываем начало игры в базу данных
 	gameID, err := m.db.StartGame(m.whiteAgent.Epsilon, m.blackAgent.Epsilon)
@@ -55,6 +117,7 @@ func (m *SelfPlayManager) PlayGame(verbose bool) error {
 	moveNumber := 0
 	var moves []struct {
 		move       game.Move
+		color      game.Color
 		evaluation float64
 		boardHash  string
 	}
@@ -75,7 +138,8 @@ func (m *SelfPlayManager) PlayGame(verbose bool) error {
 		boardHash := database.GenerateBoardHash(board)
 
 		// Выбираем ход
-		move := currentAgent.ChooseMove(board)
+		result := currentAgent.ChooseMoveContext(context.Background(), board)
+		move := result.BestMove
 		if move.From.Row == -1 {
 			break
 		}
@@ -86,63 +150,48 @@ func (m *SelfPlayManager) PlayGame(verbose bool) error {
 		// Сохраняем информацию о ходе
 		moves = append(moves, struct {
 			move       game.Move
+			color      game.Color
 			evaluation float64
 			boardHash  string
-		}{move, evaluation, boardHash})
+		}{move, board.CurrentTurn, evaluation, boardHash})
 
 		// Делаем ход
+		san := board.SAN(move)
+		line := result.SAN(board)
 		board.MakeMove(move)
+		record.Moves = append(record.Moves, move)
 		moveNumber++
 
 		if verbose && moveNumber%10 == 0 {
-			fmt.Printf("  Ход %d выполнен\n", moveNumber)
+			if result.Depth > 0 {
+				fmt.Printf("  Ход %d выполнен: %s (оценка %+.3f, вариант: %s)\n", moveNumber, san, result.Score, line)
+			} else {
+				fmt.Printf("  Ход %d выполнен: %s\n", moveNumber, san)
+			}
 		}
 	}
 
-	// Определяем результат
-	var winner string
-	var whiteReward, blackReward float64
-
-	if board.GameOver {
-		if board.Winner == game.White {
-			winner = "white"
-			whiteReward = 1.0
-			blackReward = 0.0
-		} else if board.Winner == game.Black {
-			winner = "black"
-			whiteReward = 0.0
-			blackReward = 1.0
-		} else {
-			winner = "draw"
-			whiteReward = 0.5
-			blackReward = 0.5
-		}
-	} else {
-		winner = "draw"
-		whiteReward = 0.5
-		blackReward = 0.5
+	// Партия, не закончившаяся за отведенное число ходов, засчитывается как ничья
+	if !board.GameOver {
+		board.Adjudicate(game.Draw)
 	}
 
+	// Определяем результат
+	winner := board.Result.WinnerName()
+	whiteReward := board.Result.ScoreFor(game.White)
+	blackReward := board.Result.ScoreFor(game.Black)
+
 	// Записываем все ходы в базу данных
 	for i, moveInfo := range moves {
+		// Определяем результат для каждого хода с точки зрения сделавшей его стороны
 		var result string
-		// Определяем результат для каждого хода в зависимости от того, кто его сделал
-		if i%2 == 0 { // Ход белых
-			if winner == "white" {
-				result = "win"
-			} else if winner == "black" {
-				result = "loss"
-			} else {
-				result = "draw"
-			}
-		} else { // Ход черных
-			if winner == "black" {
-				result = "win"
-			} else if winner == "white" {
-				result = "loss"
-			} else {
-				result = "draw"
-			}
+		switch board.Result.ScoreFor(moveInfo.color) {
+		case 1.0:
+			result = "win"
+		case 0.0:
+			result = "loss"
+		default:
+			result = "draw"
 		}
 
 		err := m.db.RecordMove(database.MoveRecord{
@@ -153,6 +202,7 @@ func (m *SelfPlayManager) PlayGame(verbose bool) error {
 			ToRow:      moveInfo.move.To.Row,
 			ToCol:      moveInfo.move.To.Col,
 			Evaluation: moveInfo.evaluation,
+			UCI:        moveInfo.move.UCI(),
 			BoardHash:  moveInfo.boardHash,
 			Result:     result,
 		})
@@ -162,11 +212,19 @@ func (m *SelfPlayManager) PlayGame(verbose bool) error {
 	}
 
 	// Завершаем игру в базе данных
-	err = m.db.FinishGame(gameID, winner, moveNumber)
+	err = m.db.FinishGame(gameID, winner, board.Termination.String(), moveNumber)
 	if err != nil {
 		return fmt.Errorf("ошибка при завершении игры: %v", err)
 	}
 
+	// Сохраняем партию в PGN
+	if m.PGNPath != "" {
+		record.SetResult(board)
+		if err := pgn.AppendToFile(m.PGNPath, record); err != nil {
+			return fmt.Errorf("ошибка при сохранении PGN: %v", err)
+		}
+	}
+
 	// Обучаем сеть на опыте обоих игроков
 	// Важно: оба агента используют одну сеть, поэтому обучаем её один раз
 	// на опыте обоих игроков, используя правильные награды с их перспектив
@@ -177,7 +235,7 @@ func (m *SelfPlayManager) PlayGame(verbose bool) error {
 	m.blackAgent.StateHistory = nil
 
 	if verbose {
-		fmt.Printf("=== Игра #%d завершена: %s, ходов: %d ===\n", m.gamesCount, winner, moveNumber)
+		fmt.Printf("=== Игра #%d завершена: %s (%s), ходов: %d ===\n", m.gamesCount, winner, board.Termination, moveNumber)
 		fmt.Printf("  Epsilon белых: %.4f, черных: %.4f\n", m.whiteAgent.Epsilon, m.blackAgent.Epsilon)
 	}
 
@@ -201,10 +259,11 @@ func (m *SelfPlayManager) Train(numGames int, verbose bool) error {
 			return fmt.Errorf("ошибка в игре %d: %v", i+1, err)
 		}
 
-		// Сохраняем веса каждые 10 игр
+		// Сохраняем веса каждые 10 игр (сеть у агентов общая)
 		if (i+1)%10 == 0 {
-			m.whiteAgent.Save()
-			m.blackAgent.Save()
+			if err := m.whiteAgent.Save(); err != nil {
+				return fmt.Errorf("ошибка сохранения модели: %v", err)
+			}
 
 			if verbose {
 				elapsed := time.Since(startTime)
@@ -217,8 +276,9 @@ func (m *SelfPlayManager) Train(numGames int, verbose bool) error {
 	}
 
 	// Финальное сохранение
-	m.whiteAgent.Save()
-	m.blackAgent.Save()
+	if err := m.whiteAgent.Save(); err != nil {
+		return fmt.Errorf("ошибка сохранения модели: %v", err)
+	}
 
 	if verbose {
 		totalTime := time.Since(startTime)
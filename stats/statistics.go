@@ -8,10 +8,11 @@ import (
 
 // GameResult представляет результат одной игры
 type GameResult struct {
-	GameNumber int     `json:"gameNumber"`
-	Winner     string  `json:"winner"`
-	Epsilon    float64 `json:"epsilon"`
-	MovesCount int     `json:"movesCount"`
+	GameNumber  int     `json:"gameNumber"`
+	Winner      string  `json:"winner"`                // "white", "black" или "draw"
+	Termination string  `json:"termination,omitempty"` // Причина окончания партии
+	Epsilon     float64 `json:"epsilon"`
+	MovesCount  int     `json:"movesCount"`
 }
 
 // Statistics хранит статистику игр
@@ -70,7 +71,7 @@ func (s *Statistics) Load() error {
 	return decoder.Decode(s)
 }
 
-// GetWinRate возвращает процент побед AI, игрока и ничьих
+// GetWinRate возвращает процент побед AI (черные), игрока (белые) и ничьих
 func (s *Statistics) GetWinRate() (float64, float64, float64) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
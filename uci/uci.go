@@ -0,0 +1,588 @@
+// Package uci реализует протокол Universal Chess Interface, чтобы движок можно было
+// подключать к шахматным оболочкам (Arena, Cute Chess, BanksiaGUI) и программам
+// для матчей движков вроде cutechess-cli.
+package uci
+
+import (
+	"bufio"
+	"chess-ai/agent"
+	"chess-ai/game"
+	"chess-ai/game/polyglot"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	engineName   = "ChessAI"
+	engineAuthor = "BadHellcat"
+
+	// maxThreads - предельное значение настройки Threads
+	maxThreads = 512
+	// defaultBookDepth - сколько полуходов партии движок по умолчанию играет по книге
+	defaultBookDepth = 16
+)
+
+// Engine - UCI движок поверх agent.Agent
+type Engine struct {
+	agent *agent.Agent
+	board *game.Board
+
+	out   *bufio.Writer
+	outMu sync.Mutex
+
+	options      []option
+	moveOverhead time.Duration // Запас времени на задержки связи с GUI
+	multiPV      int           // Сколько лучших вариантов сообщать при поиске
+
+	// Сила игры: уровень из Skill Level или, если включен UCI_LimitStrength, из UCI_Elo
+	skillLevel    int
+	limitStrength bool
+	elo           int
+
+	// Дебютная книга: загружается настройкой Book File, используется при включенной OwnBook
+	book      *polyglot.Book
+	ownBook   bool
+	bookDepth int  // Сколько полуходов партии играть по книге (0 - без ограничения)
+	bookBest  bool // Играть ход книги с наибольшим весом вместо случайного
+
+	// Текущий поиск
+	cancel    context.CancelFunc
+	done      chan struct{}
+	ponderHit chan struct{} // Закрывается командой ponderhit (nil, если поиск не на времени соперника)
+}
+
+// option - настройка движка, которую GUI может изменить командой setoption
+type option struct {
+	name  string
+	kind  string // "spin", "check", "combo", "button" или "string"
+	def   string
+	min   int
+	max   int
+	apply func(value string) error
+}
+
+// NewEngine создает UCI движок, который пишет ответы в out
+func NewEngine(a *agent.Agent, out io.Writer) *Engine {
+	e := &Engine{
+		agent:        a,
+		board:        game.NewBoard(),
+		out:          bufio.NewWriter(out),
+		moveOverhead: 50 * time.Millisecond,
+		multiPV:      1,
+		skillLevel:   a.SkillLevel(),
+		elo:          agent.MaxElo,
+		bookDepth:    defaultBookDepth,
+	}
+
+	e.options = []option{
+		{
+			name: "Move Overhead", kind: "spin", def: "50", min: 0, max: 5000,
+			apply: func(value string) error {
+				ms, err := strconv.Atoi(value)
+				if err != nil {
+					return err
+				}
+				e.moveOverhead = time.Duration(ms) * time.Millisecond
+				return nil
+			},
+		},
+		{
+			name: "Hash", kind: "spin", def: strconv.Itoa(agent.DefaultHashSize), min: 1, max: 4096,
+			apply: func(value string) error {
+				mb, err := strconv.Atoi(value)
+				if err != nil {
+					return err
+				}
+				if mb < 1 || mb > 4096 {
+					return fmt.Errorf("размер должен быть от 1 до 4096 МБ")
+				}
+				e.agent.SetHashSize(mb)
+				return nil
+			},
+		},
+		{
+			name: "Threads", kind: "spin", def: strconv.Itoa(a.Threads), min: 1, max: maxThreads,
+			apply: func(value string) error {
+				n, err := strconv.Atoi(value)
+				if err != nil {
+					return err
+				}
+				if n < 1 || n > maxThreads {
+					return fmt.Errorf("количество потоков должно быть от 1 до %d", maxThreads)
+				}
+				e.agent.Threads = n
+				return nil
+			},
+		},
+		{
+			name: "MultiPV", kind: "spin", def: "1", min: 1, max: 256,
+			apply: func(value string) error {
+				n, err := strconv.Atoi(value)
+				if err != nil {
+					return err
+				}
+				if n < 1 || n > 256 {
+					return fmt.Errorf("количество вариантов должно быть от 1 до 256")
+				}
+				e.multiPV = n
+				return nil
+			},
+		},
+		{
+			// Сообщает GUI, что движок умеет думать на времени соперника (go ponder)
+			name: "Ponder", kind: "check", def: "false",
+			apply: func(value string) error {
+				if value != "true" && value != "false" {
+					return fmt.Errorf("ожидается true или false")
+				}
+				return nil
+			},
+		},
+		{
+			name: "Skill Level", kind: "spin", def: strconv.Itoa(a.SkillLevel()), min: agent.MinSkillLevel, max: agent.MaxSkillLevel,
+			apply: func(value string) error {
+				n, err := strconv.Atoi(value)
+				if err != nil {
+					return err
+				}
+				if n < agent.MinSkillLevel || n > agent.MaxSkillLevel {
+					return fmt.Errorf("уровень должен быть от %d до %d", agent.MinSkillLevel, agent.MaxSkillLevel)
+				}
+				e.skillLevel = n
+				e.applySkill()
+				return nil
+			},
+		},
+		{
+			name: "UCI_LimitStrength", kind: "check", def: "false",
+			apply: func(value string) error {
+				if value != "true" && value != "false" {
+					return fmt.Errorf("ожидается true или false")
+				}
+				e.limitStrength = value == "true"
+				e.applySkill()
+				return nil
+			},
+		},
+		{
+			name: "UCI_Elo", kind: "spin", def: strconv.Itoa(agent.MaxElo), min: agent.MinElo, max: agent.MaxElo,
+			apply: func(value string) error {
+				n, err := strconv.Atoi(value)
+				if err != nil {
+					return err
+				}
+				if n < agent.MinElo || n > agent.MaxElo {
+					return fmt.Errorf("рейтинг должен быть от %d до %d", agent.MinElo, agent.MaxElo)
+				}
+				e.elo = n
+				e.applySkill()
+				return nil
+			},
+		},
+		{
+			name: "OwnBook", kind: "check", def: "false",
+			apply: func(value string) error {
+				if value != "true" && value != "false" {
+					return fmt.Errorf("ожидается true или false")
+				}
+				e.ownBook = value == "true"
+				e.applyBook()
+				return nil
+			},
+		},
+		{
+			name: "Book File", kind: "string", def: "<empty>",
+			apply: func(value string) error {
+				if value == "" || value == "<empty>" {
+					e.book = nil
+					e.applyBook()
+					return nil
+				}
+				book, err := polyglot.Open(value)
+				if err != nil {
+					return err
+				}
+				e.book = book
+				e.applyBook()
+				return nil
+			},
+		},
+		{
+			name: "Book Depth", kind: "spin", def: strconv.Itoa(defaultBookDepth), min: 0, max: 1000,
+			apply: func(value string) error {
+				n, err := strconv.Atoi(value)
+				if err != nil {
+					return err
+				}
+				if n < 0 || n > 1000 {
+					return fmt.Errorf("глубина книги должна быть от 0 до 1000 полуходов")
+				}
+				e.bookDepth = n
+				e.applyBook()
+				return nil
+			},
+		},
+		{
+			name: "Book Best Move", kind: "check", def: "false",
+			apply: func(value string) error {
+				if value != "true" && value != "false" {
+					return fmt.Errorf("ожидается true или false")
+				}
+				e.bookBest = value == "true"
+				e.applyBook()
+				return nil
+			},
+		},
+		{
+			name: "Clear Hash", kind: "button",
+			apply: func(string) error {
+				e.agent.NewGame()
+				return nil
+			},
+		},
+	}
+
+	return e
+}
+
+// applySkill передает агенту уровень силы из настроек
+func (e *Engine) applySkill() {
+	if e.limitStrength {
+		e.agent.SetSkillLevel(agent.SkillLevelForElo(e.elo))
+		return
+	}
+	e.agent.SetSkillLevel(e.skillLevel)
+}
+
+// applyBook передает агенту дебютную книгу с настройками выбора хода
+func (e *Engine) applyBook() {
+	if e.book == nil || !e.ownBook {
+		e.agent.Book = nil
+		return
+	}
+	e.book.MaxPly = e.bookDepth
+	e.book.Selection = polyglot.WeightedRandom
+	if e.bookBest {
+		e.book.Selection = polyglot.BestMove
+	}
+	e.agent.Book = e.book
+}
+
+// Run читает команды из in, пока не встретит quit или конец ввода
+func (e *Engine) Run(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "uci":
+			e.handleUCI()
+		case "isready":
+			e.send("readyok")
+		case "ucinewgame":
+			e.stopSearch()
+			e.board = game.NewBoard()
+			e.agent.NewGame()
+		case "position":
+			e.stopSearch()
+			if err := e.handlePosition(fields[1:]); err != nil {
+				e.send("info string %v", err)
+			}
+		case "go":
+			e.stopSearch()
+			e.handleGo(fields[1:])
+		case "ponderhit":
+			if e.ponderHit != nil {
+				close(e.ponderHit)
+				e.ponderHit = nil
+			}
+		case "stop":
+			e.stopSearch()
+		case "setoption":
+			e.stopSearch()
+			if err := e.handleSetOption(fields[1:]); err != nil {
+				e.send("info string %v", err)
+			}
+		case "quit":
+			e.stopSearch()
+			return nil
+		default:
+			e.send("info string неизвестная команда %s", fields[0])
+		}
+	}
+
+	e.stopSearch()
+	return scanner.Err()
+}
+
+// send отправляет строку протокола в GUI
+func (e *Engine) send(format string, args ...interface{}) {
+	e.outMu.Lock()
+	defer e.outMu.Unlock()
+	fmt.Fprintf(e.out, format+"\n", args...)
+	e.out.Flush()
+}
+
+// handleUCI отвечает на команду uci: имя движка и список настроек
+func (e *Engine) handleUCI() {
+	e.send("id name %s", engineName)
+	e.send("id author %s", engineAuthor)
+	for _, opt := range e.options {
+		switch opt.kind {
+		case "spin":
+			e.send("option name %s type spin default %s min %d max %d", opt.name, opt.def, opt.min, opt.max)
+		case "button":
+			e.send("option name %s type button", opt.name)
+		default:
+			e.send("option name %s type %s default %s", opt.name, opt.kind, opt.def)
+		}
+	}
+	e.send("uciok")
+}
+
+// handleSetOption обрабатывает "setoption name <имя> [value <значение>]"
+func (e *Engine) handleSetOption(args []string) error {
+	var name, value []string
+	target := &name
+	for i, arg := range args {
+		switch {
+		case i == 0 && arg == "name":
+			continue
+		case arg == "value" && target == &name:
+			target = &value
+			continue
+		}
+		*target = append(*target, arg)
+	}
+
+	optionName := strings.Join(name, " ")
+	for _, opt := range e.options {
+		if strings.EqualFold(opt.name, optionName) {
+			if err := opt.apply(strings.Join(value, " ")); err != nil {
+				return fmt.Errorf("неверное значение настройки %s: %v", opt.name, err)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("неизвестная настройка %s", optionName)
+}
+
+// handlePosition обрабатывает "position startpos|fen <FEN> [moves <ходы>]"
+func (e *Engine) handlePosition(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("команда position без позиции")
+	}
+
+	movesIdx := len(args)
+	for i, arg := range args {
+		if arg == "moves" {
+			movesIdx = i
+			break
+		}
+	}
+
+	var board *game.Board
+	switch args[0] {
+	case "startpos":
+		board = game.NewBoard()
+	case "fen":
+		parsed, err := game.ParseFEN(strings.Join(args[1:movesIdx], " "))
+		if err != nil {
+			return err
+		}
+		board = parsed
+	default:
+		return fmt.Errorf("неизвестный тип позиции %s", args[0])
+	}
+
+	if movesIdx < len(args) {
+		for _, s := range args[movesIdx+1:] {
+			move, err := game.ParseUCI(s)
+			if err != nil {
+				return err
+			}
+			if !board.IsValidMove(move) {
+				return fmt.Errorf("недопустимый ход %s в позиции %s", s, board.FEN())
+			}
+			board.MakeMove(move)
+		}
+	}
+
+	e.board = board
+	return nil
+}
+
+// parseGo разбирает параметры команды go в ограничения поиска для стороны turn.
+// Неизвестные параметры пропускаются. Также возвращаются признаки go infinite и go ponder.
+func parseGo(args []string, turn game.Color) (limits agent.SearchLimits, infinite, ponder bool) {
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "infinite":
+			infinite = true
+			continue
+		case "ponder":
+			ponder = true
+			continue
+		}
+		if i+1 >= len(args) {
+			break
+		}
+
+		n, err := strconv.ParseInt(args[i+1], 10, 64)
+		if err != nil {
+			continue
+		}
+		ms := time.Duration(n) * time.Millisecond
+		switch args[i] {
+		case "depth":
+			limits.Depth = int(n)
+		case "nodes":
+			limits.Nodes = uint64(n)
+		case "movetime":
+			limits.MoveTime = ms
+		case "wtime":
+			if turn == game.White {
+				limits.TimeLeft = ms
+			}
+		case "btime":
+			if turn == game.Black {
+				limits.TimeLeft = ms
+			}
+		case "winc":
+			if turn == game.White {
+				limits.Increment = ms
+			}
+		case "binc":
+			if turn == game.Black {
+				limits.Increment = ms
+			}
+		case "movestogo":
+			limits.MovesToGo = int(n)
+		default:
+			continue
+		}
+		i++
+	}
+
+	// В режиме infinite часы не учитываются
+	if infinite {
+		limits.MoveTime, limits.TimeLeft, limits.Increment = 0, 0, 0
+	}
+	return limits, infinite, ponder
+}
+
+// handleGo запускает поиск в отдельной горутине, чтобы во время поиска
+// можно было отвечать на isready и stop
+func (e *Engine) handleGo(args []string) {
+	limits, infinite, ponder := parseGo(args, e.board.CurrentTurn)
+	limits.MoveOverhead = e.moveOverhead
+
+	// При go ponder позиция уже содержит ожидаемый ход соперника. Ограничения
+	// по времени начинают действовать после ponderhit.
+	var ponderHit chan struct{}
+	if ponder {
+		ponderHit = make(chan struct{})
+		limits.Ponder = ponderHit
+	}
+	e.ponderHit = ponderHit
+
+	ctx, cancel := context.WithCancel(context.Background())
+	e.cancel = cancel
+	e.done = make(chan struct{})
+	go e.search(ctx, e.board.Clone(), limits, e.multiPV, infinite, ponderHit, e.done)
+}
+
+// stopSearch прерывает текущий поиск и ждет, пока движок сообщит bestmove
+func (e *Engine) stopSearch() {
+	if e.cancel == nil {
+		return
+	}
+	e.cancel()
+	<-e.done
+	e.cancel = nil
+	e.done = nil
+	e.ponderHit = nil
+}
+
+// search выполняет поиск и сообщает лучший ход
+func (e *Engine) search(ctx context.Context, board *game.Board, limits agent.SearchLimits, multiPV int, infinite bool, ponderHit <-chan struct{}, done chan struct{}) {
+	defer close(done)
+
+	e.agent.Color = board.CurrentTurn
+
+	// Ход из книги играется сразу, если GUI ждет ответа без анализа
+	if !infinite && ponderHit == nil {
+		if move, ok := e.agent.BookMove(board); ok {
+			e.send("info string ход из дебютной книги")
+			e.send("bestmove %s", move.UCI())
+			return
+		}
+	}
+
+	best, lines := e.agent.SearchLines(ctx, board, limits, multiPV, e.sendInfo)
+
+	// В режиме infinite bestmove отправляется только после stop,
+	// а при поиске на времени соперника - после ponderhit или stop
+	if infinite {
+		<-ctx.Done()
+	} else if ponderHit != nil {
+		select {
+		case <-ponderHit:
+		case <-ctx.Done():
+		}
+	}
+
+	if len(lines) == 0 {
+		e.send("bestmove 0000")
+		return
+	}
+
+	// Второй ход главного варианта - ожидаемый ответ соперника, о котором можно думать
+	if pv := best.PV; len(pv) >= 2 {
+		e.send("bestmove %s ponder %s", pv[0].UCI(), pv[1].UCI())
+		return
+	}
+	e.send("bestmove %s", best.BestMove.UCI())
+}
+
+// sendInfo отправляет сведения о завершенной итерации поиска, по строке на каждый вариант
+func (e *Engine) sendInfo(lines []agent.SearchResult) {
+	for i, result := range lines {
+		pv := make([]string, len(result.PV))
+		for j, move := range result.PV {
+			pv[j] = move.UCI()
+		}
+
+		ms := result.Time.Milliseconds()
+		nps := uint64(0)
+		if result.Time > 0 {
+			nps = uint64(float64(result.Nodes) / result.Time.Seconds())
+		}
+
+		e.send("info depth %d multipv %d score %s nodes %d nps %d time %d pv %s",
+			result.Depth, i+1, uciScore(result.Score), result.Nodes, nps, ms, strings.Join(pv, " "))
+	}
+}
+
+// uciScore записывает оценку для info: "mate N" при найденном мате (N в ходах,
+// отрицательное, если мат ставят движку), иначе "cp N"
+func uciScore(score float64) string {
+	if moves, ok := agent.MateIn(score); ok {
+		return fmt.Sprintf("mate %d", moves)
+	}
+	return fmt.Sprintf("cp %d", centipawns(score))
+}
+
+// centipawns переводит оценку нейросети (от -1 до 1) в сотые доли пешки для GUI
+func centipawns(score float64) int {
+	return int(math.Round(score * 1000))
+}
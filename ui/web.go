@@ -3,10 +3,15 @@ package ui
 import (
 	"chess-ai/agent"
 	"chess-ai/game"
+	"chess-ai/game/pgn"
+	"chess-ai/neural"
 	"chess-ai/stats"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"os"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -17,6 +22,22 @@ type WebUI struct {
 	agent      *agent.Agent
 	statistics *stats.Statistics
 	mutex      sync.Mutex
+	startFEN   string             // Начальная позиция для новых партий (пустая - стандартная)
+	record     *pgn.Game          // Запись текущей партии
+	history    []string           // Ходы текущей партии в SAN
+	startTurn  game.Color         // Очередь хода в начальной позиции партии
+	startMove  int                // Номер хода в начальной позиции партии
+	pgnPath    string             // Файл для сохранения завершенных партий (пустая строка - не сохранять)
+	version    int                // Счетчик изменений партии, чтобы не применять устаревший ход AI
+	aiCancel   context.CancelFunc // Прерывает текущий поиск хода AI
+	analysis   *AnalysisState     // Результат поиска последнего хода AI
+	ponder     *ponderSearch      // Поиск AI на времени игрока (nil, если не идет)
+
+	// Анализ по запросу (/api/analyze) идет без блокировки; перед обучением нейросети
+	// он прерывается, и обучение дожидается его завершения
+	analyses       map[int]context.CancelFunc // Прерывают идущие анализы
+	nextAnalysis   int                        // Номер следующего анализа
+	analysesActive sync.WaitGroup             // Идущие анализы
 	
 	// Для режима самообучения
 	selfPlayRunning bool
@@ -27,15 +48,218 @@ type WebUI struct {
 
 // NewWebUI создает новый веб-интерфейс
 func NewWebUI(board *game.Board, agentAI *agent.Agent, statistics *stats.Statistics) *WebUI {
-	return &WebUI{
-		board:           board,
+	w := &WebUI{
 		agent:           agentAI,
 		statistics:      statistics,
+		analyses:        make(map[int]context.CancelFunc),
 		selfPlayRunning: false,
 		selfPlayStop:    make(chan bool),
 		whiteAgent:      agent.NewAgent(game.White),
 		blackAgent:      agent.NewAgent(game.Black),
 	}
+	// Агенты самообучения учат общую копию сети AI и сохраняют ее в отдельный
+	// файл (см. SetSelfPlayModelPath), чтобы не затирать модель AI
+	w.whiteAgent.Network = agentAI.Network.Clone()
+	w.blackAgent.Network = w.whiteAgent.Network
+	w.whiteAgent.Limits = agent.SelfPlaySearchLimits
+	w.blackAgent.Limits = agent.SelfPlaySearchLimits
+	w.whiteAgent.Explore = true
+	w.blackAgent.Explore = true
+	// Партии самообучения начинаются с дебютов из той же книги, что и у AI
+	w.whiteAgent.Book = agentAI.Book
+	w.blackAgent.Book = agentAI.Book
+	w.setBoard(board, "Human", "ChessAI")
+	return w
+}
+
+// SetSelfPlayModelPath задает файл модели агентов самообучения и загружает ее,
+// если файл уже есть. Иначе самообучение начинается с копии сети AI.
+func (w *WebUI) SetSelfPlayModelPath(path string) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.whiteAgent.ModelPath = path
+	w.blackAgent.ModelPath = path
+	if err := w.whiteAgent.Load(); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	w.blackAgent.Network = w.whiteAgent.Network
+	return nil
+}
+
+// SelfPlayNetwork возвращает общую нейросеть агентов самообучения
+func (w *WebUI) SelfPlayNetwork() *neural.Network {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.whiteAgent.Network
+}
+
+// SetPGNPath задает файл, в который дописываются завершенные партии
+func (w *WebUI) SetPGNPath(path string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.pgnPath = path
+}
+
+// setBoard начинает новую запись партии с указанной позиции (must be called with mutex held)
+func (w *WebUI) setBoard(board *game.Board, white, black string) {
+	w.board = board
+	w.record = pgn.NewGame(white, black)
+	w.record.SetStartPosition(board)
+	w.history = nil
+	w.startTurn = board.CurrentTurn
+	w.startMove = board.MovesCount/2 + 1
+	w.analysis = nil
+	w.version++
+	w.cancelAIMove()
+}
+
+// applyMove выполняет ход и добавляет его в запись партии (must be called with mutex held)
+func (w *WebUI) applyMove(move game.Move) {
+	w.history = append(w.history, w.board.SAN(move))
+	w.board.MakeMove(move)
+	w.record.Moves = append(w.record.Moves, move)
+	w.version++
+}
+
+// takeBack отменяет последний ход игрока вместе с ответом AI (must be called with mutex held).
+// Возвращает количество отмененных полуходов.
+func (w *WebUI) takeBack() int {
+	undone := 0
+	for w.board.CanUnmakeMove() && (undone == 0 || w.board.CurrentTurn == w.agent.Color) {
+		w.board.UnmakeMove()
+		if len(w.history) > 0 {
+			w.history = w.history[:len(w.history)-1]
+			w.record.Moves = w.record.Moves[:len(w.record.Moves)-1]
+		}
+		undone++
+
+		// Состояние, записанное AI перед отмененным ходом, больше не относится к партии
+		if w.board.CurrentTurn == w.agent.Color && len(w.agent.StateHistory) > 0 {
+			w.agent.StateHistory = w.agent.StateHistory[:len(w.agent.StateHistory)-1]
+		}
+	}
+	if undone > 0 {
+		w.analysis = nil
+		w.version++
+		w.cancelAIMove()
+	}
+	return undone
+}
+
+// cancelAIMove прерывает поиск хода AI и поиск на времени игрока, результат которых
+// больше не нужен (must be called with mutex held)
+func (w *WebUI) cancelAIMove() {
+	if w.aiCancel != nil {
+		w.aiCancel()
+		w.aiCancel = nil
+	}
+	w.stopPondering()
+}
+
+// ponderSearch - поиск хода AI в позиции после ожидаемого хода игрока, который идет,
+// пока игрок думает. Если игрок сделал ожидаемый ход, поиск продолжается уже
+// с ограничением по времени, иначе его результат отбрасывается.
+type ponderSearch struct {
+	hash   uint64                  // Ключ позиции после ожидаемого хода
+	move   string                  // Ожидаемый ход игрока в SAN
+	hit    chan struct{}           // Закрывается, когда игрок сделал ожидаемый ход
+	cancel context.CancelFunc      // Прерывает поиск
+	result chan agent.SearchResult // Результат поиска (буфер на одно значение)
+}
+
+// startPondering начинает думать на времени игрока над позицией после его ожидаемого
+// хода - второго хода главного варианта result (must be called with mutex held)
+func (w *WebUI) startPondering(result agent.SearchResult) {
+	if w.board.GameOver || len(result.PV) < 2 || !w.board.IsValidMove(result.PV[1]) {
+		return
+	}
+
+	board := w.board.Clone()
+	san := board.SAN(result.PV[1])
+	board.MakeMove(result.PV[1])
+	if board.GameOver {
+		return
+	}
+
+	hit := make(chan struct{})
+	limits := w.agent.Limits
+	limits.Ponder = hit
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &ponderSearch{
+		hash:   board.Hash(),
+		move:   san,
+		hit:    hit,
+		cancel: cancel,
+		result: make(chan agent.SearchResult, 1),
+	}
+	go func() {
+		p.result <- w.agent.ChooseMoveLimits(ctx, board, limits)
+	}()
+	w.ponder = p
+}
+
+// stopPondering прерывает поиск на времени игрока и дожидается его завершения,
+// чтобы после этого можно было обучать нейросеть (must be called with mutex held)
+func (w *WebUI) stopPondering() {
+	if w.ponder == nil {
+		return
+	}
+	w.ponder.cancel()
+	<-w.ponder.result
+	w.ponder = nil
+}
+
+// startAnalysis регистрирует анализ по запросу и возвращает его контекст, который
+// отменяется вместе с запросом или перед обучением нейросети (must be called with mutex held).
+// После анализа нужно вызвать finishAnalysis с возвращенным номером.
+func (w *WebUI) startAnalysis(parent context.Context) (context.Context, int) {
+	ctx, cancel := context.WithCancel(parent)
+	id := w.nextAnalysis
+	w.nextAnalysis++
+	w.analyses[id] = cancel
+	w.analysesActive.Add(1)
+	return ctx, id
+}
+
+// finishAnalysis отмечает завершение анализа id (must be called without mutex held)
+func (w *WebUI) finishAnalysis(id int) {
+	// Сначала сообщаем о завершении: stopAnalyses ждет его, удерживая мьютекс
+	w.analysesActive.Done()
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if cancel, ok := w.analyses[id]; ok {
+		cancel()
+		delete(w.analyses, id)
+	}
+}
+
+// stopAnalyses прерывает анализы по запросу и дожидается их завершения, чтобы
+// после этого можно было обучать нейросеть (must be called with mutex held).
+// Новые анализы не начнутся, пока мьютекс удерживается.
+func (w *WebUI) stopAnalyses() {
+	for id, cancel := range w.analyses {
+		cancel()
+		delete(w.analyses, id)
+	}
+	w.analysesActive.Wait()
+}
+
+// SetStartFEN задает начальную позицию, с которой начинаются новые партии
+func (w *WebUI) SetStartFEN(fen string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.startFEN = fen
+}
+
+// newBoard создает доску для новой партии (must be called with mutex held)
+func (w *WebUI) newBoard() *game.Board {
+	if w.startFEN != "" {
+		if board, err := game.ParseFEN(w.startFEN); err == nil {
+			return board
+		}
+	}
+	return game.NewBoard()
 }
 
 // Start запускает веб-сервер
@@ -44,7 +268,11 @@ func (w *WebUI) Start(port int) error {
 	http.HandleFunc("/api/state", w.handleState)
 	http.HandleFunc("/api/move", w.handleMove)
 	http.HandleFunc("/api/reset", w.handleReset)
+	http.HandleFunc("/api/undo", w.handleUndo)
 	http.HandleFunc("/api/stats", w.handleStats)
+	http.HandleFunc("/api/pgn", w.handlePGN)
+	http.HandleFunc("/api/analyze", w.handleAnalyze)
+	http.HandleFunc("/api/skill", w.handleSkill)
 	http.HandleFunc("/api/selfplay/start", w.handleSelfPlayStart)
 	http.HandleFunc("/api/selfplay/stop", w.handleSelfPlayStop)
 	http.HandleFunc("/api/selfplay/status", w.handleSelfPlayStatus)
@@ -55,7 +283,7 @@ func (w *WebUI) Start(port int) error {
 	server := &http.Server{
 		Addr:         addr,
 		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
+		WriteTimeout: writeTimeout,
 		IdleTimeout:  60 * time.Second,
 	}
 	return server.ListenAndServe()
@@ -72,10 +300,37 @@ type BoardState struct {
 	Cells       [8][8]CellState `json:"cells"`
 	CurrentTurn string          `json:"currentTurn"`
 	GameOver    bool            `json:"gameOver"`
-	Winner      string          `json:"winner"`
+	Winner      string          `json:"winner"`      // "white", "black", "draw" или "" во время игры
+	Result      string          `json:"result"`      // Результат в нотации PGN
+	Termination string          `json:"termination"` // Причина окончания партии
 	IsCheck     bool            `json:"isCheck"`
 	Epsilon     float64         `json:"epsilon"`
+	SkillLevel  int             `json:"skillLevel"` // Уровень силы AI (0-20)
 	MovesCount  int             `json:"movesCount"`
+	FEN         string          `json:"fen"`
+	History     []string        `json:"history"`         // Ходы партии в SAN
+	StartTurn   string          `json:"startTurn"`       // Очередь хода в начальной позиции партии
+	StartMove   int             `json:"startMoveNumber"` // Номер хода в начальной позиции партии
+	Analysis    *AnalysisState  `json:"analysis,omitempty"`
+	Ponder      string          `json:"ponder,omitempty"` // Ход игрока, над ответом на который AI думает заранее
+}
+
+// AnalysisState - сведения о поиске, которым AI выбрал последний ход
+type AnalysisState struct {
+	Score float64 `json:"score"` // Оценка позиции для AI
+	Depth int     `json:"depth"` // Глубина поиска (0 - ход выбран без поиска)
+	Nodes uint64  `json:"nodes"`
+	PV    string  `json:"pv"` // Ожидаемый вариант в SAN, начиная с хода AI
+}
+
+// newAnalysisState описывает результат поиска в позиции board перед ходом AI
+func newAnalysisState(board *game.Board, result agent.SearchResult) *AnalysisState {
+	return &AnalysisState{
+		Score: result.Score,
+		Depth: result.Depth,
+		Nodes: result.Nodes,
+		PV:    result.SAN(board),
+	}
 }
 
 // CellState представляет состояние клетки
@@ -97,10 +352,21 @@ func (w *WebUI) writeState(rw http.ResponseWriter) {
 	state := BoardState{
 		CurrentTurn: colorToString(w.board.CurrentTurn),
 		GameOver:    w.board.GameOver,
-		Winner:      colorToString(w.board.Winner),
+		Winner:      w.board.Result.WinnerName(),
+		Result:      w.board.Result.String(),
+		Termination: w.board.Termination.String(),
 		IsCheck:     w.board.IsCheck,
 		Epsilon:     w.agent.Epsilon,
+		SkillLevel:  w.agent.SkillLevel(),
 		MovesCount:  w.board.MovesCount,
+		FEN:         w.board.FEN(),
+		History:     w.history,
+		StartTurn:   colorToString(w.startTurn),
+		StartMove:   w.startMove,
+		Analysis:    w.analysis,
+	}
+	if w.ponder != nil {
+		state.Ponder = w.ponder.move
 	}
 
 	for row := 0; row < 8; row++ {
@@ -119,12 +385,16 @@ func (w *WebUI) writeState(rw http.ResponseWriter) {
 	}
 }
 
-// MoveRequest представляет запрос на ход
+// MoveRequest представляет запрос на ход: координаты клеток либо
+// строка Move в нотации SAN ("Nf3") или UCI ("g1f3")
 type MoveRequest struct {
-	FromRow int `json:"fromRow"`
-	FromCol int `json:"fromCol"`
-	ToRow   int `json:"toRow"`
-	ToCol   int `json:"toCol"`
+	FromRow int    `json:"fromRow"`
+	FromCol int    `json:"fromCol"`
+	ToRow   int    `json:"toRow"`
+	ToCol   int    `json:"toCol"`
+	Move    string `json:"move,omitempty"`
+	// Promotion - фигура превращения пешки: "queen", "rook", "bishop" или "knight"
+	Promotion string `json:"promotion,omitempty"`
 }
 
 // handleMove обрабатывает ход игрока
@@ -138,16 +408,39 @@ func (w *WebUI) handleMove(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.FromRow < 0 || req.FromRow > 7 || req.FromCol < 0 || req.FromCol > 7 ||
-		req.ToRow < 0 || req.ToRow > 7 || req.ToCol < 0 || req.ToCol > 7 {
-		w.mutex.Unlock()
-		http.Error(rw, "Invalid coordinates", http.StatusBadRequest)
-		return
-	}
+	var move game.Move
+	if req.Move != "" {
+		parsed, err := w.board.ParseMove(req.Move)
+		if err != nil {
+			w.mutex.Unlock()
+			http.Error(rw, "Invalid move: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		move = parsed
+	} else {
+		if req.FromRow < 0 || req.FromRow > 7 || req.FromCol < 0 || req.FromCol > 7 ||
+			req.ToRow < 0 || req.ToRow > 7 || req.ToCol < 0 || req.ToCol > 7 {
+			w.mutex.Unlock()
+			http.Error(rw, "Invalid coordinates", http.StatusBadRequest)
+			return
+		}
+
+		move = game.Move{
+			From: game.Position{Row: req.FromRow, Col: req.FromCol},
+			To:   game.Position{Row: req.ToRow, Col: req.ToCol},
+		}
 
-	move := game.Move{
-		From: game.Position{Row: req.FromRow, Col: req.FromCol},
-		To:   game.Position{Row: req.ToRow, Col: req.ToCol},
+		// Фигура превращения учитывается только для пешки на последней горизонтали
+		piece := w.board.Cells[req.FromRow][req.FromCol]
+		if req.Promotion != "" && piece.Type == game.Pawn && (req.ToRow == 0 || req.ToRow == 7) {
+			promotion, ok := stringToPieceType(req.Promotion)
+			if !ok {
+				w.mutex.Unlock()
+				http.Error(rw, "Invalid promotion piece", http.StatusBadRequest)
+				return
+			}
+			move.Promotion = promotion
+		}
 	}
 
 	if !w.board.IsValidMove(move) {
@@ -156,7 +449,7 @@ func (w *WebUI) handleMove(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.board.MakeMove(move)
+	w.applyMove(move)
 
 	// Capture state before releasing mutex
 	gameOver := w.board.GameOver
@@ -177,69 +470,89 @@ func (w *WebUI) handleMove(rw http.ResponseWriter, r *http.Request) {
 
 	// Process AI move asynchronously if it's AI's turn
 	if !gameOver && currentTurn == aiColor {
-		go func() {
-			// Clone board for AI computation
-			w.mutex.Lock()
-			boardClone := w.board.Clone()
-			
-			// Record state before making move (with mutex held)
-			w.agent.RecordState(boardClone)
-			w.mutex.Unlock()
+		go w.playAIMove()
+	}
+}
 
-			// Compute AI move without holding mutex (can take 10+ seconds)
-			aiMove := w.agent.ChooseMove(boardClone)
+// playAIMove вычисляет и выполняет ход AI (must be called without mutex held)
+func (w *WebUI) playAIMove() {
+	aiColor := w.agent.Color
 
-			// Re-acquire mutex to apply the move
-			w.mutex.Lock()
-			defer w.mutex.Unlock()
+	w.mutex.Lock()
+	version := w.version
+	var choose func() agent.SearchResult
+	if p := w.ponder; p != nil && p.hash == w.board.Hash() {
+		// Игрок сделал ожидаемый ход: продолжаем начатый поиск, теперь с ограничением по времени
+		close(p.hit)
+		w.ponder = nil
+		w.aiCancel = p.cancel
+		choose = func() agent.SearchResult { return <-p.result }
+	} else {
+		// Clone board for AI computation
+		w.stopPondering()
+		boardClone := w.board.Clone()
+		ctx, cancel := context.WithCancel(context.Background())
+		w.aiCancel = cancel
+		choose = func() agent.SearchResult { return w.agent.ChooseMoveContext(ctx, boardClone) }
+	}
+	cancel := w.aiCancel
+	w.mutex.Unlock()
+	defer cancel()
 
-			// Verify game state is still valid (game not reset, still AI's turn)
-			if !w.board.GameOver && w.board.CurrentTurn == aiColor {
-				w.board.MakeMove(aiMove)
+	// Compute AI move without holding mutex (reset or take-back cancels the search)
+	result := choose()
 
-				if w.board.GameOver {
-					w.handleGameEnd()
-				}
-			}
-		}()
+	// Re-acquire mutex to apply the move
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	// Verify game state is still valid (game not reset, no take-back, still AI's turn)
+	if w.version == version && !w.board.GameOver && w.board.CurrentTurn == aiColor {
+		// Record state before making move (only for moves that are actually played)
+		w.agent.RecordState(w.board)
+		w.analysis = newAnalysisState(w.board, result)
+		w.applyMove(result.BestMove)
+
+		if w.board.GameOver {
+			w.handleGameEnd()
+		} else {
+			w.startPondering(result)
+		}
 	}
 }
 
 // handleGameEnd handles the end of game, learning and statistics (must be called with mutex held)
 func (w *WebUI) handleGameEnd() {
-	var reward float64
-	
-	// Determine if it's a draw: game is over and no checkmate occurred
-	// In board.go, draws set Winner to White (stalemate or move limit)
-	isDraw := w.board.GameOver && !w.board.IsCheck
-	
-	if isDraw {
-		reward = 0.5 // Draw
-	} else if w.board.Winner == w.agent.Color {
-		reward = 1.0 // AI won
-	} else {
-		reward = 0.0 // AI lost
-	}
+	// Нейросеть нельзя обучать, пока ею пользуется поиск
+	w.stopPondering()
+	w.stopAnalyses()
+
+	reward := w.board.Result.ScoreFor(w.agent.Color)
 	
 	// Train the AI
 	w.agent.Learn(reward)
-	w.agent.Save()
+	if err := w.agent.Save(); err != nil {
+		fmt.Printf("Не удалось сохранить модель: %v\n", err)
+	}
 	
 	gameNumber := len(w.statistics.GetStats()) + 1
 	
-	// Determine winner string for stats
-	winnerStr := "draw"
-	if !isDraw {
-		winnerStr = colorToString(w.board.Winner)
-	}
-	
 	result := stats.GameResult{
-		GameNumber: gameNumber,
-		Winner:     winnerStr,
-		Epsilon:    w.agent.Epsilon,
-		MovesCount: w.board.MovesCount,
+		GameNumber:  gameNumber,
+		Winner:      w.board.Result.WinnerName(),
+		Termination: w.board.Termination.String(),
+		Epsilon:     w.agent.Epsilon,
+		MovesCount:  w.board.MovesCount,
 	}
 	w.statistics.AddGame(result)
+
+	// Save the finished game to PGN
+	if w.pgnPath != "" {
+		w.record.SetResult(w.board)
+		if err := pgn.AppendToFile(w.pgnPath, w.record); err != nil {
+			fmt.Printf("Failed to save PGN: %v\n", err)
+		}
+	}
 	
 	// Reset state history for next game
 	w.agent.StateHistory = nil
@@ -251,43 +564,66 @@ func (w *WebUI) handleReset(rw http.ResponseWriter, r *http.Request) {
 	w.mutex.Lock()
 	defer w.mutex.Unlock()
 
-	w.board.CurrentTurn = game.White
-	w.board.GameOver = false
-	w.board.Winner = game.White
-	w.board.EnPassantTarget = nil
-	w.board.WhiteKingMoved = false
-	w.board.WhiteRookAMoved = false
-	w.board.WhiteRookHMoved = false
-	w.board.BlackKingMoved = false
-	w.board.BlackRookAMoved = false
-	w.board.BlackRookHMoved = false
-	w.board.MovesCount = 0
-	
-	for i := 0; i < 8; i++ {
-		for j := 0; j < 8; j++ {
-			w.board.Cells[i][j] = game.Piece{Type: game.Empty, Color: game.White}
-		}
+	w.setBoard(w.newBoard(), "Human", "ChessAI")
+	w.agent.NewGame()
+
+	// Если по начальной позиции первым ходит AI, запускаем его ход
+	if !w.board.GameOver && w.board.CurrentTurn == w.agent.Color {
+		go w.playAIMove()
 	}
-	
-	w.board.Cells[0] = [8]game.Piece{
-		{game.Rook, game.Black}, {game.Knight, game.Black}, {game.Bishop, game.Black}, {game.Queen, game.Black},
-		{game.King, game.Black}, {game.Bishop, game.Black}, {game.Knight, game.Black}, {game.Rook, game.Black},
+
+	rw.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(rw).Encode(map[string]string{"status": "ok"}); err != nil {
+		http.Error(rw, "Failed to encode response", http.StatusInternalServerError)
 	}
-	for i := 0; i < 8; i++ {
-		w.board.Cells[1][i] = game.Piece{game.Pawn, game.Black}
+}
+
+// handleUndo отменяет последний ход игрока и ответ AI
+func (w *WebUI) handleUndo(rw http.ResponseWriter, r *http.Request) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.board.GameOver {
+		http.Error(rw, "Game is over", http.StatusBadRequest)
+		return
 	}
-	w.board.Cells[7] = [8]game.Piece{
-		{game.Rook, game.White}, {game.Knight, game.White}, {game.Bishop, game.White}, {game.Queen, game.White},
-		{game.King, game.White}, {game.Bishop, game.White}, {game.Knight, game.White}, {game.Rook, game.White},
+	if w.takeBack() == 0 {
+		http.Error(rw, "No moves to undo", http.StatusBadRequest)
+		return
 	}
-	for i := 0; i < 8; i++ {
-		w.board.Cells[6][i] = game.Piece{game.Pawn, game.White}
+
+	// Если отменены все ходы и первым ходит AI, запускаем его ход заново
+	if w.board.CurrentTurn == w.agent.Color {
+		go w.playAIMove()
 	}
-	
-	rw.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(rw).Encode(map[string]string{"status": "ok"}); err != nil {
-		http.Error(rw, "Failed to encode response", http.StatusInternalServerError)
+
+	w.writeState(rw)
+}
+
+// SkillRequest - запрос на изменение уровня силы AI
+type SkillRequest struct {
+	Level int `json:"level"`
+}
+
+// handleSkill меняет уровень силы AI. Обдумывание на времени игрока прерывается,
+// чтобы следующий ход AI сделал уже на новом уровне.
+func (w *WebUI) handleSkill(rw http.ResponseWriter, r *http.Request) {
+	var req SkillRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(rw, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if req.Level < agent.MinSkillLevel || req.Level > agent.MaxSkillLevel {
+		http.Error(rw, fmt.Sprintf("Skill level must be between %d and %d", agent.MinSkillLevel, agent.MaxSkillLevel), http.StatusBadRequest)
+		return
 	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.stopPondering()
+	w.agent.SetSkillLevel(req.Level)
+	w.writeState(rw)
 }
 
 // handleStats возвращает статистику
@@ -301,6 +637,120 @@ func (w *WebUI) handleStats(rw http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handlePGN возвращает запись текущей партии в формате PGN
+func (w *WebUI) handlePGN(rw http.ResponseWriter, r *http.Request) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.record.SetResult(w.board)
+	rw.Header().Set("Content-Type", "application/x-chess-pgn; charset=utf-8")
+	rw.Write([]byte(w.record.String()))
+}
+
+// AnalysisLine - один вариант анализа позиции
+type AnalysisLine struct {
+	Move  string  `json:"move"` // Ход в SAN
+	UCI   string  `json:"uci"`
+	Score float64 `json:"score"` // Оценка для стороны, которая делает ход
+	Depth int     `json:"depth"`
+	PV    string  `json:"pv"` // Вариант в SAN, начиная с хода
+}
+
+// AnalysisResponse - ответ /api/analyze
+type AnalysisResponse struct {
+	FEN   string         `json:"fen"`
+	Nodes uint64         `json:"nodes"`
+	Lines []AnalysisLine `json:"lines"`
+}
+
+// writeTimeout ограничивает время ответа на запрос
+const writeTimeout = 10 * time.Second
+
+// maxAnalysisTime ограничивает время анализа по запросу. Оно меньше writeTimeout
+// с запасом на завершение поиска и отправку ответа, иначе сервер оборвет соединение.
+const maxAnalysisTime = 8 * time.Second
+
+// handleAnalyze возвращает несколько лучших ходов с оценками и вариантами.
+// Параметры запроса: fen (по умолчанию текущая позиция), multipv (по умолчанию 3),
+// movetime в миллисекундах (по умолчанию 1000, не больше 8 секунд) и depth.
+func (w *WebUI) handleAnalyze(rw http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	multiPV, err := queryInt(query.Get("multipv"), 3)
+	if err != nil || multiPV < 1 {
+		http.Error(rw, "Invalid multipv", http.StatusBadRequest)
+		return
+	}
+	moveTime, err := queryInt(query.Get("movetime"), 1000)
+	if err != nil || moveTime < 1 {
+		http.Error(rw, "Invalid movetime", http.StatusBadRequest)
+		return
+	}
+	depth, err := queryInt(query.Get("depth"), 0)
+	if err != nil || depth < 0 {
+		http.Error(rw, "Invalid depth", http.StatusBadRequest)
+		return
+	}
+
+	limits := agent.SearchLimits{
+		Depth:    depth,
+		MoveTime: minDuration(time.Duration(moveTime)*time.Millisecond, maxAnalysisTime),
+	}
+
+	var board *game.Board
+	if fen := query.Get("fen"); fen != "" {
+		board, err = game.ParseFEN(fen)
+		if err != nil {
+			http.Error(rw, "Invalid FEN: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	w.mutex.Lock()
+	if board == nil {
+		board = w.board.Clone()
+	}
+	ctx, id := w.startAnalysis(r.Context())
+	w.mutex.Unlock()
+
+	// Анализ идет без блокировки, как и поиск хода AI; закрытие запроса или окончание
+	// партии (обучение нейросети) прерывает его
+	lines := w.agent.AnalyzeContext(ctx, board, limits, multiPV, nil)
+	w.finishAnalysis(id)
+
+	response := AnalysisResponse{FEN: board.FEN(), Lines: []AnalysisLine{}}
+	for _, line := range lines {
+		response.Nodes = line.Nodes
+		response.Lines = append(response.Lines, AnalysisLine{
+			Move:  board.SAN(line.BestMove),
+			UCI:   line.BestMove.UCI(),
+			Score: line.Score,
+			Depth: line.Depth,
+			PV:    line.SAN(board),
+		})
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(rw).Encode(response); err != nil {
+		http.Error(rw, "Failed to encode analysis", http.StatusInternalServerError)
+	}
+}
+
+// queryInt разбирает целый параметр запроса, возвращая def для пустого значения
+func queryInt(value string, def int) (int, error) {
+	if value == "" {
+		return def, nil
+	}
+	return strconv.Atoi(value)
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
+
 // handleSelfPlayStart запускает режим самообучения
 func (w *WebUI) handleSelfPlayStart(rw http.ResponseWriter, r *http.Request) {
 	w.mutex.Lock()
@@ -377,12 +827,15 @@ func (w *WebUI) runSelfPlay() {
 		default:
 			w.mutex.Lock()
 			// Сбрасываем доску для новой игры
-			w.board = game.NewBoard()
+			w.setBoard(w.newBoard(), "ChessAI (white)", "ChessAI (black)")
 			w.whiteAgent.StateHistory = nil
 			w.blackAgent.StateHistory = nil
+			w.whiteAgent.NewGame()
+			w.blackAgent.NewGame()
 			w.mutex.Unlock()
 			
 			// Играем одну игру
+		gameLoop:
 			for {
 				select {
 				case <-w.selfPlayStop:
@@ -392,25 +845,14 @@ func (w *WebUI) runSelfPlay() {
 					
 					if w.board.GameOver {
 						// Обучаем агентов
-						var whiteReward, blackReward float64
-						if w.board.Winner == game.White {
-							whiteReward = 1.0
-							blackReward = 0.0
-						} else if w.board.Winner == game.Black {
-							whiteReward = 0.0
-							blackReward = 1.0
-						} else {
-							whiteReward = 0.5
-							blackReward = 0.5
+						w.whiteAgent.Learn(w.board.Result.ScoreFor(game.White))
+						w.blackAgent.Learn(w.board.Result.ScoreFor(game.Black))
+						if err := w.whiteAgent.Save(); err != nil {
+							fmt.Printf("Не удалось сохранить модель самообучения: %v\n", err)
 						}
 						
-						w.whiteAgent.Learn(whiteReward)
-						w.blackAgent.Learn(blackReward)
-						w.whiteAgent.Save()
-						w.blackAgent.Save()
-						
 						w.mutex.Unlock()
-						break
+						break gameLoop
 					}
 					
 					// Выбираем текущего агента
@@ -428,11 +870,11 @@ func (w *WebUI) runSelfPlay() {
 					move := currentAgent.ChooseMove(w.board)
 					if move.From.Row == -1 {
 						w.mutex.Unlock()
-						break
+						break gameLoop
 					}
 					
 					// Делаем ход
-					w.board.MakeMove(move)
+					w.applyMove(move)
 					w.mutex.Unlock()
 					
 					// Небольшая пауза для визуализации (100ms)
@@ -454,6 +896,20 @@ func colorToString(c game.Color) string {
 	return "black"
 }
 
+func stringToPieceType(s string) (game.PieceType, bool) {
+	switch s {
+	case "queen", "q":
+		return game.Queen, true
+	case "rook", "r":
+		return game.Rook, true
+	case "bishop", "b":
+		return game.Bishop, true
+	case "knight", "n":
+		return game.Knight, true
+	}
+	return game.Empty, false
+}
+
 func pieceTypeToString(pt game.PieceType) string {
 	switch pt {
 	case game.Pawn:
@@ -686,6 +1142,22 @@ const htmlPage = `<!DOCTYPE html>
                 <div class="controls">
                     <button class="primary" onclick="resetGame()">🔄 New Game</button>
                     <button class="secondary" onclick="resetGame()">♻️ Reset</button>
+                    <button class="secondary" onclick="undoMove()">↩️ Undo</button>
+                    <button class="secondary" onclick="analyzePosition()">🔍 Analyze</button>
+                    <button class="secondary" onclick="window.open('/api/pgn')">📄 Export PGN</button>
+                    <label style="display: block; margin-top: 10px;">
+                        Promote pawn to:
+                        <select id="promotionPiece">
+                            <option value="queen">♕ Queen</option>
+                            <option value="rook">♖ Rook</option>
+                            <option value="bishop">♗ Bishop</option>
+                            <option value="knight">♘ Knight</option>
+                        </select>
+                    </label>
+                    <label style="display: block; margin-top: 10px;">
+                        AI strength:
+                        <select id="skillLevel" onchange="setSkill()"></select>
+                    </label>
                 </div>
                 
                 <div class="stats-section">
@@ -735,6 +1207,17 @@ const htmlPage = `<!DOCTYPE html>
                         <span class="stat-value" id="movesCount">0</span>
                     </div>
                 </div>
+                
+                <div class="stats-section">
+                    <h3>📜 Moves</h3>
+                    <div id="moveList" style="font-family: monospace; line-height: 1.6;"></div>
+                </div>
+                
+                <div class="stats-section">
+                    <h3>🔍 AI Analysis</h3>
+                    <div id="analysis" style="font-family: monospace; line-height: 1.6;">-</div>
+                    <div id="analysisLines" style="font-family: monospace; line-height: 1.6; margin-top: 8px;"></div>
+                </div>
             </div>
             
             <div class="center-panel">
@@ -829,7 +1312,7 @@ const htmlPage = `<!DOCTYPE html>
                 const response = await fetch('/api/move', {
                     method: 'POST',
                     headers: { 'Content-Type': 'application/json' },
-                    body: JSON.stringify({ fromRow, fromCol, toRow, toCol })
+                    body: JSON.stringify({ fromRow, fromCol, toRow, toCol, promotion: document.getElementById('promotionPiece').value })
                 });
                 
                 if (response.ok) {
@@ -843,6 +1326,72 @@ const htmlPage = `<!DOCTYPE html>
             }
         }
         
+        async function undoMove() {
+            try {
+                const response = await fetch('/api/undo', { method: 'POST' });
+                if (response.ok) {
+                    selectedCell = null;
+                    await loadState();
+                } else {
+                    console.error('Cannot undo move');
+                }
+            } catch (error) {
+                console.error('Error undoing move:', error);
+            }
+        }
+        
+        async function analyzePosition() {
+            const el = document.getElementById('analysisLines');
+            el.textContent = 'Analyzing...';
+            try {
+                const response = await fetch('/api/analyze?multipv=3&movetime=2000');
+                if (!response.ok) {
+                    el.textContent = 'Analysis failed';
+                    return;
+                }
+                const analysis = await response.json();
+                el.innerHTML = '';
+                analysis.lines.forEach((line, i) => {
+                    const div = document.createElement('div');
+                    const score = (line.score >= 0 ? '+' : '') + line.score.toFixed(3);
+                    div.textContent = (i + 1) + '. ' + score + ' (d' + line.depth + ') ' + line.pv;
+                    el.appendChild(div);
+                });
+            } catch (error) {
+                el.textContent = 'Analysis failed';
+                console.error('Error analyzing position:', error);
+            }
+        }
+        
+        function initSkillSelect() {
+            const select = document.getElementById('skillLevel');
+            for (let level = 0; level <= 20; level++) {
+                const option = document.createElement('option');
+                option.value = level;
+                option.textContent = level === 20 ? '20 (full)' : level;
+                select.appendChild(option);
+            }
+        }
+        
+        async function setSkill() {
+            const level = parseInt(document.getElementById('skillLevel').value);
+            try {
+                const response = await fetch('/api/skill', {
+                    method: 'POST',
+                    headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify({ level })
+                });
+                if (response.ok) {
+                    boardState = await response.json();
+                    updateStats();
+                } else {
+                    console.error('Cannot set skill level');
+                }
+            } catch (error) {
+                console.error('Error setting skill level:', error);
+            }
+        }
+        
         async function loadState() {
             try {
                 const response = await fetch('/api/state');
@@ -893,6 +1442,9 @@ const htmlPage = `<!DOCTYPE html>
                 } else {
                     statusBar.textContent = '🤝 Draw!';
                 }
+                if (boardState.termination) {
+                    statusBar.textContent += ' (' + boardState.termination + ')';
+                }
             } else {
                 let turnText = (boardState.currentTurn === 'white' ? 'White' : 'Black') + "'s Turn";
                 if (boardState.isCheck) {
@@ -952,7 +1504,44 @@ const htmlPage = `<!DOCTYPE html>
                 const epsilon = boardState.epsilon !== undefined ? boardState.epsilon.toFixed(4) : '-';
                 const moves = boardState.movesCount !== undefined ? boardState.movesCount : 0;
                 document.getElementById('currentEpsilon').textContent = epsilon;
+                if (boardState.skillLevel !== undefined) {
+                    document.getElementById('skillLevel').value = boardState.skillLevel;
+                }
                 document.getElementById('movesCount').textContent = moves;
+                updateMoveList();
+            }
+        }
+        
+        function updateMoveList() {
+            // Партия может начинаться из позиции FEN: с хода черных и не с первого хода
+            const history = boardState.history || [];
+            const parts = [];
+            let number = boardState.startMoveNumber || 1;
+            let i = 0;
+            if (boardState.startTurn === 'black' && history.length > 0) {
+                parts.push(number + '... ' + history[0]);
+                number++;
+                i = 1;
+            }
+            for (; i < history.length; i += 2, number++) {
+                parts.push(number + '. ' + history[i] + (history[i + 1] ? ' ' + history[i + 1] : ''));
+            }
+            document.getElementById('moveList').textContent = parts.join('  ');
+            updateAnalysis();
+        }
+        
+        function updateAnalysis() {
+            const analysis = boardState.analysis;
+            const el = document.getElementById('analysis');
+            if (!analysis || analysis.depth === 0) {
+                el.textContent = '-';
+                return;
+            }
+            const score = (analysis.score >= 0 ? '+' : '') + analysis.score.toFixed(3);
+            el.textContent = 'Eval ' + score + ', depth ' + analysis.depth + ', ' +
+                analysis.nodes + ' nodes: ' + analysis.pv;
+            if (boardState.ponder) {
+                el.textContent += ' (pondering on ' + boardState.ponder + ')';
             }
         }
         
@@ -1161,6 +1750,7 @@ const htmlPage = `<!DOCTYPE html>
         
         // Initialize
         createBoard();
+        initSkillSelect();
         loadState();
         loadStats();
         checkSelfPlayStatus();